@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	ARG_FORMAT = "format"
+
+	ANALYZE_FORMAT_JSON  = "json"
+	ANALYZE_FORMAT_TABLE = "table"
+)
+
+// analyzeOutput holds the analysis of a single file, as printed by the analyze command
+type analyzeOutput struct {
+	File    string                `json:"file"`
+	Results *tasks.AnalyzeResults `json:"results,omitempty"`
+	Error   string                `json:"error,omitempty"`
+}
+
+// analyzeCmd represents the analyze command
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze [input files...]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Prints stream and frame information for video files",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format := viper.GetString(ARG_FORMAT)
+		if format != ANALYZE_FORMAT_JSON && format != ANALYZE_FORMAT_TABLE {
+			return fmt.Errorf("unknown format: %s", format)
+		}
+		cmd.SilenceUsage = true
+
+		baseLogger, _ := newLogger(zap.InfoLevel)
+		defer baseLogger.Sync()
+		logger := baseLogger.Sugar()
+
+		task := &tasks.AnalyzeVideo{
+			Logger:           logger,
+			UseLowerPriority: viper.GetBool(ARG_LOW_PRIORITY),
+			UseThreads:       true,
+		}
+
+		ctx, stopSignals := handleSignals(context.Background(), logger, false, func() {})
+		defer stopSignals()
+
+		outputs := make([]analyzeOutput, 0, len(args))
+		failed := 0
+		for _, input := range args {
+			output := analyzeOutput{File: input}
+			results, err := task.Do(ctx, input)
+			if err != nil {
+				logger.Errorw("error while analyzing video", "filename", input, "err", err)
+				output.Error = err.Error()
+				failed++
+			} else {
+				output.Results = results
+			}
+			outputs = append(outputs, output)
+		}
+
+		switch format {
+		case ANALYZE_FORMAT_JSON:
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(outputs); err != nil {
+				return err
+			}
+		case ANALYZE_FORMAT_TABLE:
+			writeAnalyzeTable(os.Stdout, outputs)
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d files could not be analyzed", failed, len(args))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(analyzeCmd)
+
+	analyzeCmd.Flags().String(ARG_FORMAT, ANALYZE_FORMAT_TABLE, "Output format (table, json)")
+	analyzeCmd.Flags().Bool(ARG_LOW_PRIORITY, false, "Runs ffprobe at a lower process priority")
+}
+
+// writeAnalyzeTable prints a row for every file, followed by a row for each of its streams
+func writeAnalyzeTable(w io.Writer, outputs []analyzeOutput) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tSTREAM\tTYPE\tCODEC\tLANGUAGE\tDETAILS")
+
+	for _, output := range outputs {
+		if output.Results == nil {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\terror: %s\n", output.File, output.Error)
+			continue
+		}
+
+		results := output.Results
+		fmt.Fprintf(tw, "%s\t-\t-\t-\t-\tduration %s, %d frames, %s\n",
+			output.File, results.Duration.Round(time.Second), results.TotalFrames, results.Resolution())
+
+		for _, stream := range results.Streams {
+			language := stream.Language
+			if language == "" {
+				language = "-"
+			}
+			fmt.Fprintf(tw, "\t%d\t%s\t%s\t%s\t%s\n",
+				stream.Index, stream.Type, stream.Codec, language, formatStreamDetails(stream))
+		}
+	}
+
+	tw.Flush()
+}
+
+func formatStreamDetails(stream tasks.StreamInfo) string {
+	details := make([]string, 0)
+	switch stream.Type {
+	case "audio":
+		details = append(details, fmt.Sprintf("%d channels", stream.Channels))
+	case "video":
+		details = append(details, fmt.Sprintf("%dx%d", stream.Width, stream.Height))
+		if stream.HDR {
+			details = append(details, fmt.Sprintf("HDR (%s)", stream.ColorTransfer))
+		}
+	}
+
+	if stream.BitRate > 0 {
+		details = append(details, fmt.Sprintf("%d kb/s", stream.BitRate/1000))
+	}
+
+	if len(details) == 0 {
+		return "-"
+	}
+	return strings.Join(details, ", ")
+}
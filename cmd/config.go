@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	ARG_CONFIG  = "config"
+	ARG_PROFILE = "profile"
+
+	CONFIG_PROFILES_KEY = "profiles"
+)
+
+// loadConfig reads the config file, if there is one, and applies the selected profile on top of it.
+//
+// Keys in the config file are the same as the command line flags, and act as defaults for them.  Profiles are named
+// sets of the same keys, stored under "profiles":
+//
+//	output: /media/library
+//	low-priority: true
+//	profiles:
+//	  anime:
+//	    split: true
+//	    template: [/etc/robin/anime.yaml]
+//	    plex-media-type: tv
+func loadConfig() error {
+	path := viper.GetString(ARG_CONFIG)
+	if path != "" {
+		viper.SetConfigFile(path)
+	} else {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			// No default location on this system, so there's nothing to load
+			return nil
+		}
+		viper.SetConfigFile(filepath.Join(configDir, "robin", "config.yaml"))
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		// The default config file is optional, but one given explicitly must exist
+		if path == "" && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("error while reading config file: %s", err)
+	}
+
+	profile := viper.GetString(ARG_PROFILE)
+	if profile == "" {
+		return nil
+	}
+
+	settings := viper.Sub(CONFIG_PROFILES_KEY + "." + profile)
+	if settings == nil {
+		return fmt.Errorf("unknown profile: %s", profile)
+	}
+
+	// Merged settings take precedence over the rest of the config file, but not over flags or environment variables
+	if err := viper.MergeConfigMap(settings.AllSettings()); err != nil {
+		return fmt.Errorf("error while applying profile %s: %s", profile, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/jobs"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	ARG_JOB_DB     = "job-db"
+	ARG_OLDER_THAN = "older-than"
+	ARG_STATUS     = "status"
+)
+
+// jobsCmd represents the jobs command
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Lists, retries and purges the jobs run by serve",
+	Long: `Manages the jobs stored by serve in its job database.  These commands can
+be used while the server is running, which picks up retried jobs within a
+few seconds.`,
+}
+
+// jobsListCmd represents the jobs list command
+var jobsListCmd = &cobra.Command{
+	Use:   "list",
+	Args:  cobra.NoArgs,
+	Short: "Lists jobs, oldest first",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		statuses, err := getJobStatuses()
+		if err != nil {
+			return err
+		}
+		store, err := openJobStore()
+		if err != nil {
+			return err
+		}
+
+		all, err := store.List()
+		if err != nil {
+			return err
+		}
+		var listed []jobs.Job
+		for _, job := range all {
+			if len(statuses) == 0 || hasJobStatus(statuses, job.Status) {
+				listed = append(listed, job)
+			}
+		}
+
+		writeJobs(os.Stdout, listed)
+		return nil
+	},
+}
+
+// jobsRetryCmd represents the jobs retry command
+var jobsRetryCmd = &cobra.Command{
+	Use:   "retry [job id...]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Queues finished jobs to run again from the start",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		manager, err := newJobManager()
+		if err != nil {
+			return err
+		}
+
+		var errs []error
+		for _, id := range args {
+			if _, err := manager.Retry(id); err != nil {
+				errs = append(errs, fmt.Errorf("error while retrying job %s: %w", id, err))
+				continue
+			}
+			fmt.Printf("queued job %s\n", id)
+		}
+
+		return errors.Join(errs...)
+	},
+}
+
+// jobsPurgeCmd represents the jobs purge command
+var jobsPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Args:  cobra.NoArgs,
+	Short: "Deletes finished jobs",
+	Long: `Deletes finished jobs from the job database.  By default every done,
+failed and cancelled job is deleted, which --status and --older-than narrow
+down.  Outputs are left in place.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		statuses, err := getJobStatuses()
+		if err != nil {
+			return err
+		}
+		if len(statuses) == 0 {
+			statuses = []jobs.Status{jobs.StatusDone, jobs.StatusFailed, jobs.StatusCancelled}
+		}
+		for _, status := range statuses {
+			if !status.Finished() {
+				return fmt.Errorf("only finished jobs can be purged, not %s jobs", status)
+			}
+		}
+
+		olderThan := viper.GetInt(ARG_OLDER_THAN)
+		if olderThan < 0 {
+			return fmt.Errorf("--%s must not be negative", ARG_OLDER_THAN)
+		}
+
+		manager, err := newJobManager()
+		if err != nil {
+			return err
+		}
+
+		purged, err := manager.Purge(statuses, time.Now().AddDate(0, 0, -olderThan))
+		fmt.Printf("purged %d jobs\n", len(purged))
+		return err
+	},
+}
+
+// openJobStore opens the job database given by flags, or the default one in the user config dir
+func openJobStore() (*jobs.BoltStore, error) {
+	path := viper.GetString(ARG_JOB_DB)
+	if path == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("no default location for the job database, set --%s: %v", ARG_JOB_DB, err)
+		}
+		path = filepath.Join(configDir, "robin", "jobs.db")
+	}
+
+	return jobs.OpenBoltStore(path)
+}
+
+// newJobManager returns a manager for changing stored jobs, which never runs them
+func newJobManager() (*jobs.Manager, error) {
+	store, err := openJobStore()
+	if err != nil {
+		return nil, err
+	}
+
+	return &jobs.Manager{
+		Logger:    zap.NewNop().Sugar(),
+		QueueSize: viper.GetInt(ARG_QUEUE_SIZE),
+		Store:     store,
+	}, nil
+}
+
+func getJobStatuses() ([]jobs.Status, error) {
+	var statuses []jobs.Status
+	for _, name := range viper.GetStringSlice(ARG_STATUS) {
+		status, err := jobs.ParseStatus(name)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func hasJobStatus(statuses []jobs.Status, status jobs.Status) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJobs prints a table of jobs
+func writeJobs(w io.Writer, list []jobs.Job) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "ID\tSTATUS\tUPDATED\tINPUTS\tDETAILS")
+	for _, job := range list {
+		updated := job.Created
+		if len(job.History) > 0 {
+			updated = job.History[len(job.History)-1].Time
+		}
+
+		details := ""
+		switch {
+		case job.Error != "":
+			details = job.Error
+		case job.Status == jobs.StatusDone:
+			details = fmt.Sprintf("%d outputs", len(job.Outputs))
+		case job.File != "":
+			details = job.File
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", job.ID, job.Status, updated.Local().Format(time.DateTime),
+			strings.Join(job.Spec.Inputs, ", "), details)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(jobsCmd)
+	jobsCmd.PersistentFlags().String(ARG_JOB_DB, "", "Job database shared with serve (default is robin/jobs.db in the user config dir)")
+
+	jobsCmd.AddCommand(jobsListCmd)
+	jobsListCmd.Flags().StringSlice(ARG_STATUS, nil, "Only lists jobs with these statuses ("+strings.Join(jobs.Statuses(), ", ")+")")
+
+	jobsCmd.AddCommand(jobsRetryCmd)
+	jobsRetryCmd.Flags().Int(ARG_QUEUE_SIZE, 16, "Number of jobs that can wait to run before retries are refused")
+
+	jobsCmd.AddCommand(jobsPurgeCmd)
+	jobsPurgeCmd.Flags().Int(ARG_OLDER_THAN, 0, "Only purges jobs that finished at least this many days ago")
+	jobsPurgeCmd.Flags().StringSlice(ARG_STATUS, nil, "Only purges jobs with these statuses (default done, failed and cancelled)")
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/neptune-media/robin/pkg/manifest"
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	ARG_LIBRARY_DIR = "library-dir"
+
+	MANIFEST_PREFIX = "robin-manifest-"
+)
+
+// verifyManifestCmd represents the verify-manifest command
+var verifyManifestCmd = &cobra.Command{
+	Use:   "verify-manifest [manifest file]",
+	Args:  cobra.ExactArgs(1),
+	Short: "Checks that the outputs listed in a manifest still match their checksums",
+	Long: `Checks every output listed in a manifest written by robin, comparing
+sizes and SHA-256 digests.  Output paths are relative to the directory
+holding the manifest, unless --library-dir is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		m, err := manifest.Read(args[0])
+		if err != nil {
+			return err
+		}
+
+		dir := viper.GetString(ARG_LIBRARY_DIR)
+		if dir == "" {
+			dir = filepath.Dir(args[0])
+		}
+
+		checks := m.Verify(dir)
+		failed := writeManifestChecks(os.Stdout, checks)
+		if failed > 0 {
+			return fmt.Errorf("%d of %d outputs failed verification", failed, len(checks))
+		}
+
+		return nil
+	},
+}
+
+// writeManifest records the outputs of results, and the templates used for them, in a new manifest in outputDir
+func writeManifest(logger *zap.SugaredLogger, outputDir string, templates []string, results []pipeline.Result) error {
+	m, err := manifest.New(logger, VERSION, outputDir, templates, results)
+	if err != nil {
+		return err
+	}
+	if len(m.Outputs()) == 0 {
+		logger.Infow("no outputs to record in manifest")
+		return nil
+	}
+
+	// Another run may have written a manifest in the same second
+	path := pipeline.AvailablePath(filepath.Join(outputDir, MANIFEST_PREFIX+m.Created.Format("20060102-150405")+".json"))
+	base := strings.TrimSuffix(path, ".json")
+	if err := m.Write(base + ".json"); err != nil {
+		return err
+	}
+	logger.Infow("wrote manifest", "path", base+".json", "outputs", len(m.Outputs()))
+
+	if viper.GetBool(ARG_MANIFEST_SHA256SUMS) {
+		if err := m.WriteSHA256Sums(base + ".SHA256SUMS"); err != nil {
+			return err
+		}
+		logger.Infow("wrote checksums", "path", base+".SHA256SUMS")
+	}
+
+	return nil
+}
+
+// writeManifestChecks prints a table of check results, and returns how many of them failed
+func writeManifestChecks(w io.Writer, checks []manifest.Check) int {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	failed := 0
+	fmt.Fprintln(tw, "STATUS\tPATH\tDETAILS")
+	for _, check := range checks {
+		details := ""
+		switch check.Status {
+		case manifest.StatusOK:
+		case manifest.StatusError:
+			details = check.Err.Error()
+			failed++
+		default:
+			details = fmt.Sprintf("expected %d bytes, sha256 %s", check.File.Size, check.File.SHA256)
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", strings.ToUpper(string(check.Status)), check.Path, details)
+	}
+
+	return failed
+}
+
+func init() {
+	rootCmd.AddCommand(verifyManifestCmd)
+	verifyManifestCmd.Flags().String(ARG_LIBRARY_DIR, "", "Directory that output paths in the manifest are relative to (default is the manifest's directory)")
+}
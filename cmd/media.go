@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/neptune-media/robin/pkg/naming"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// getMedia returns the media details given by flags, adjusted by override when it's set.  The media type is only
+// required when outputs are named by a library convention, and templates are free to ignore it.
+func getMedia(library naming.Namer, override func(naming.Media) naming.Media) (naming.Media, error) {
+	media := naming.Media{
+		Edition: viper.GetString(ARG_PLEX_EDITION),
+		Episode: viper.GetInt(ARG_PLEX_EPISODE),
+		Name:    viper.GetString(ARG_PLEX_NAME),
+		Season:  viper.GetInt(ARG_PLEX_SEASON),
+		Type:    naming.MediaType(viper.GetString(ARG_PLEX_MEDIA_TYPE)),
+		Year:    viper.GetInt(ARG_PLEX_YEAR),
+	}
+	if override != nil {
+		media = override(media)
+	}
+
+	typeName := string(media.Type)
+
+	if library == nil || (typeName == "" && viper.GetString(ARG_NAME_TEMPLATE) != "") {
+		return media, nil
+	}
+
+	mediaType, err := naming.ParseMediaType(typeName)
+	if err != nil {
+		return media, fmt.Errorf("invalid --%s: %v", ARG_PLEX_MEDIA_TYPE, err)
+	}
+	media.Type = mediaType
+	return media, nil
+}
+
+// validateMedia checks the media details that every input will be named with
+func validateMedia(defaults naming.Media, inputMedia map[string]naming.Media, inputs []string) error {
+	for _, input := range inputs {
+		media, ok := inputMedia[input]
+		if !ok {
+			if err := defaults.Validate(); err != nil {
+				return fmt.Errorf("invalid media details (check the --plex-* flags): %v", err)
+			}
+			continue
+		}
+
+		if err := media.Validate(); err != nil {
+			return fmt.Errorf("invalid media details for %s (check the --plex-* flags, or the filename): %v", input, err)
+		}
+	}
+
+	return nil
+}
+
+// parseInputMedia infers media details from the name of each input.  Values set by flags, environment or config
+// always take precedence over parsed values.
+func parseInputMedia(logger *zap.SugaredLogger, defaults naming.Media, inputs []string) map[string]naming.Media {
+	results := make(map[string]naming.Media)
+	for _, input := range inputs {
+		parsed, ok := naming.ParseFilename(input)
+		if !ok {
+			logger.Infow("no media details found in filename", "input", input)
+			continue
+		}
+
+		// An episode number of 0 carries on numbering from the previous input
+		media := defaults
+		media.Episode = 0
+
+		if parsed.Name != "" && !viper.IsSet(ARG_PLEX_NAME) {
+			media.Name = parsed.Name
+		}
+		if parsed.Year > 0 && !viper.IsSet(ARG_PLEX_YEAR) {
+			media.Year = parsed.Year
+		}
+		if parsed.HasSeason && !viper.IsSet(ARG_PLEX_SEASON) {
+			media.Season = parsed.Season
+		}
+		if parsed.HasEpisode && !viper.IsSet(ARG_PLEX_EPISODE) {
+			media.Episode = parsed.Episode
+		}
+		if parsed.EpisodeTitle != "" && !viper.GetBool(ARG_SPLIT) {
+			// A title only describes the input when it isn't split into several episodes
+			media.EpisodeTitle = parsed.EpisodeTitle
+		}
+
+		logger.Infow("inferred media details from filename",
+			"input", input,
+			"pattern", parsed.Pattern,
+			"name", media.Name,
+			"year", media.Year,
+			"season", media.Season,
+			"episode", media.Episode,
+			"episode-title", media.EpisodeTitle,
+			"disc", parsed.Disc,
+		)
+		results[input] = media
+	}
+
+	return results
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/naming"
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"github.com/neptune-media/robin/pkg/tasks"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pipelineOverrides replaces settings from flags and the config file, for jobs submitted to the server
+type pipelineOverrides struct {
+	Media     func(defaults naming.Media) naming.Media // Adjusts the media details given by flags, when set
+	Templates []string                                 // Template files to use instead of --template, when set
+}
+
+// newPipeline builds a pipeline for inputs from flags and the config file.  Every setting is checked before the work
+// dir and output dir are created.  Neither is created for a dry run.  The returned function removes the work dir.
+func newPipeline(logger *zap.SugaredLogger, inputs []string, resume, dryRun bool, overrides pipelineOverrides) (*pipeline.Pipeline, string, func(*zap.SugaredLogger), error) {
+	library, err := getLibraryNamer()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	extraType := viper.GetString(ARG_EXTRA_TYPE)
+	if err := naming.ValidateExtra(extraType); err != nil {
+		return nil, "", nil, err
+	}
+
+	collision, err := pipeline.ParseCollisionPolicy(viper.GetString(ARG_ON_COLLISION))
+	if err != nil {
+		return nil, "", nil, err
+	}
+	transfer, err := pipeline.ParseTransferMode(viper.GetString(ARG_TRANSFER_MODE))
+	if err != nil {
+		return nil, "", nil, err
+	}
+	spaceCheck, err := pipeline.ParseSpaceCheck(viper.GetString(ARG_SPACE_CHECK))
+	if err != nil {
+		return nil, "", nil, err
+	}
+	// Container durations of a source and its output rarely match to the millisecond, so an exact match isn't offered
+	if viper.GetInt(ARG_VERIFY_DURATION_TOLERANCE) < 1 {
+		return nil, "", nil, fmt.Errorf("--%s must be at least 1 second", ARG_VERIFY_DURATION_TOLERANCE)
+	}
+
+	// Check the media details before any expensive work starts, since mistakes there only show up in output names
+	media, err := getMedia(library, overrides.Media)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	var inputMedia map[string]naming.Media
+	if viper.GetBool(ARG_PARSE_FILENAMES) {
+		inputMedia = parseInputMedia(logger, media, inputs)
+	}
+	if library != nil && viper.GetString(ARG_NAME_TEMPLATE) == "" {
+		if err := validateMedia(media, inputMedia, inputs); err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	var splitOpts tasks.SplitVideoOptions
+	if viper.GetBool(ARG_SPLIT) {
+		splitOpts, err = getSplitVideoOptions()
+		if err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	templates := overrides.Templates
+	if templates == nil {
+		templates = viper.GetStringSlice(ARG_TEMPLATE)
+	}
+	var transcodeOpts tasks.TranscodeVideoOptions
+	if err := loadTemplates(&transcodeOpts, templates); err != nil {
+		logger.Errorw("error while loading templates", "err", err)
+		return nil, "", nil, err
+	}
+
+	// Create a temporary directory for storing intermediate files in.  A dry run only needs a path to show in the plan.
+	var tempDir string
+	cleanup := func(*zap.SugaredLogger) {}
+	if dryRun {
+		base := viper.GetString(ARG_WORKDIR)
+		if base == "" {
+			base = os.TempDir()
+		}
+		tempDir = filepath.Join(base, "robin-dry-run")
+	} else {
+		tempDir, cleanup, err = createTaskDirectory(inputs, resume)
+		if err != nil {
+			logger.Errorw("error while creating work dir", "err", err)
+			return nil, "", nil, err
+		}
+	}
+
+	// Create the output directory to store results in
+	outputDir := viper.GetString(ARG_OUTPUT)
+	if !dryRun {
+		outputDir, err = createOutputDirectory()
+		if err != nil {
+			logger.Errorw("error while creating output dir", "err", err)
+			cleanup(logger)
+			return nil, "", nil, err
+		}
+	}
+
+	pipe := &pipeline.Pipeline{
+		Collision:           collision,
+		ContinueOnError:     viper.GetBool(ARG_CONTINUE_ON_ERROR),
+		DoubleEpisodeLength: time.Duration(viper.GetInt(ARG_DOUBLE_EPISODE_LENGTH)) * time.Minute,
+		ExtraMaxLength:      time.Duration(viper.GetInt(ARG_EXTRA_MAX_LENGTH)) * time.Minute,
+		ExtraType:           extraType,
+		Library:             library,
+		Logger:              logger,
+		Media:               media,
+		InputMedia:          inputMedia,
+		OutputDir:           outputDir,
+		SpaceCheck:          spaceCheck,
+		Transfer:            transfer,
+		Workers:             viper.GetInt(ARG_WORKERS),
+	}
+
+	if resume {
+		journalPath := filepath.Join(tempDir, pipeline.JournalFilename)
+		pipe.Journal, err = pipeline.OpenJournal(journalPath, newJournalSettings(pipe, transcodeOpts))
+		if err != nil {
+			logger.Errorw("error while opening journal", "path", journalPath, "err", err)
+			cleanup(logger)
+			return nil, "", nil, err
+		}
+		logger.Infow("resuming from journal", "path", journalPath)
+	}
+
+	if viper.GetBool(ARG_SPLIT) {
+		// Setup the split video task
+		pipe.Split = &tasks.SplitVideo{
+			Logger:           logger,
+			Options:          splitOpts,
+			UseLowerPriority: viper.GetBool(ARG_LOW_PRIORITY),
+			WorkDir:          tempDir,
+		}
+	}
+
+	if !viper.GetBool(ARG_SKIP_ANALYZE) {
+		// Setup the analyze task
+		pipe.Analyze = &tasks.AnalyzeVideo{
+			Logger:           logger,
+			UseLowerPriority: viper.GetBool(ARG_LOW_PRIORITY),
+			UseThreads:       true,
+		}
+	}
+
+	// Setup the transcoding task
+	pipe.Transcode = &tasks.TranscodeVideo{
+		Logger:           logger,
+		Options:          transcodeOpts,
+		UseLowerPriority: viper.GetBool(ARG_LOW_PRIORITY),
+		WorkDir:          tempDir,
+	}
+
+	if viper.GetBool(ARG_VERIFY) || viper.GetBool(ARG_VERIFY_FULL_DECODE) {
+		// Setup the verify task
+		pipe.Verify = &tasks.VerifyVideo{
+			DurationTolerance: time.Duration(viper.GetInt(ARG_VERIFY_DURATION_TOLERANCE)) * time.Second,
+			FullDecode:        viper.GetBool(ARG_VERIFY_FULL_DECODE),
+			Logger:            logger,
+			UseLowerPriority:  viper.GetBool(ARG_LOW_PRIORITY),
+		}
+	}
+
+	return pipe, tempDir, cleanup, nil
+}
+
+// newJournalSettings returns digests of the settings that files recorded in the journal depend on, so resuming with
+// different naming flags or templates doesn't reuse outputs named or transcoded the old way
+func newJournalSettings(pipe *pipeline.Pipeline, transcodeOpts tasks.TranscodeVideoOptions) pipeline.JournalSettings {
+	namingSettings := struct {
+		Library             string
+		NameTemplate        string
+		Plex                bool
+		Media               naming.Media
+		InputMedia          map[string]naming.Media
+		OutputDir           string
+		ExtraType           string
+		ExtraMaxLength      time.Duration
+		DoubleEpisodeLength time.Duration
+	}{
+		Library:             viper.GetString(ARG_LIBRARY),
+		NameTemplate:        viper.GetString(ARG_NAME_TEMPLATE),
+		Plex:                viper.GetBool(ARG_PLEX),
+		Media:               pipe.Media,
+		InputMedia:          pipe.InputMedia,
+		OutputDir:           pipe.OutputDir,
+		ExtraType:           pipe.ExtraType,
+		ExtraMaxLength:      pipe.ExtraMaxLength,
+		DoubleEpisodeLength: pipe.DoubleEpisodeLength,
+	}
+
+	return pipeline.JournalSettings{
+		Naming:    digestSettings(namingSettings),
+		Templates: digestSettings(transcodeOpts),
+	}
+}
+
+// digestSettings returns the sha256 digest of settings encoded as JSON
+func digestSettings(settings interface{}) string {
+	data, _ := json.Marshal(settings)
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"io"
+)
+
+const (
+	PLAN_FORMAT_JSON = "json"
+	PLAN_FORMAT_TEXT = "text"
+)
+
+// writePlan prints what the pipeline would do for inputs, without encoding anything
+func writePlan(ctx context.Context, w io.Writer, pipe *pipeline.Pipeline, inputs []string, format string) error {
+	plans, err := pipe.Plan(ctx, inputs)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case PLAN_FORMAT_JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plans)
+	case PLAN_FORMAT_TEXT:
+		pipeline.WritePlans(w, plans)
+		return nil
+	}
+
+	return fmt.Errorf("unknown plan format: %s", format)
+}
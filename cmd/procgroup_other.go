@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package cmd
+
+import "os/exec"
+
+// detachProcessGroup is only supported on linux, macOS, FreeBSD and Windows, and does nothing elsewhere
+func detachProcessGroup(cmd *exec.Cmd) {}
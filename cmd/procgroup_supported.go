@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package cmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcessGroup starts cmd in a process group of its own, so signals sent to robin's group from the terminal
+// don't reach it.  Only robin decides when it stops.
+func detachProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
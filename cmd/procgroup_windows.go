@@ -0,0 +1,14 @@
+//go:build windows
+
+package cmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcessGroup starts cmd in a process group of its own, so Ctrl-C in the console doesn't reach it.  Only robin
+// decides when it stops.
+func detachProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
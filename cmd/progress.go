@@ -0,0 +1,330 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	PROGRESS_ALWAYS = "always"
+	PROGRESS_AUTO   = "auto"
+	PROGRESS_NEVER  = "never"
+
+	defaultTerminalWidth   = 80 // Used when the width of the terminal isn't known
+	progressBarWidth       = 24
+	progressRenderInterval = 250 * time.Millisecond
+)
+
+var stageActivities = map[pipeline.Stage]string{
+	pipeline.StageSplit:     "splitting",
+	pipeline.StageAnalyze:   "analyzing",
+	pipeline.StageTranscode: "transcoding",
+	pipeline.StageVerify:    "verifying",
+	pipeline.StageCopy:      "copying",
+}
+
+// useProgressDisplay reports whether a run should show the progress display, rather than log to stderr
+func useProgressDisplay(mode string) (bool, error) {
+	switch mode {
+	case PROGRESS_ALWAYS:
+		return true, nil
+	case PROGRESS_AUTO:
+		return isTerminal(os.Stderr), nil
+	case PROGRESS_NEVER:
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown progress mode: %s (expected one of %s, %s, %s)", mode, PROGRESS_AUTO, PROGRESS_ALWAYS, PROGRESS_NEVER)
+}
+
+// isTerminal reports whether f is a terminal, rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// newFileLogger returns a logger that writes to the file at path, for runs where stderr shows the progress display.
+// The default path is a new file under robin/logs in the user cache dir.
+func newFileLogger(path string) (*zap.Logger, string, error) {
+	if path == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			dir = os.TempDir()
+		}
+		path = filepath.Join(dir, "robin", "logs", fmt.Sprintf("robin-%s.log", time.Now().Format("20060102-150405")))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, "", err
+	}
+
+	cfg := zap.NewProductionConfig()
+	cfg.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
+	cfg.OutputPaths = []string{path}
+	cfg.ErrorOutputPaths = []string{path}
+	logger, err := cfg.Build()
+	if err != nil {
+		return nil, "", fmt.Errorf("error while opening log file: %v", err)
+	}
+	return logger, path, nil
+}
+
+// progressDisplay redraws a few lines of a terminal with the progress of a run, from pipeline events
+type progressDisplay struct {
+	w       io.Writer
+	started time.Time
+	stop    chan struct{}
+	done    chan struct{}
+
+	mu         sync.Mutex
+	inputs     int
+	input      string // Latest input to start
+	inputIndex int
+	splitting  bool
+	inputFiles map[int][2]int // Files finished and total files, for inputs that are being processed
+	inputsDone int
+	stored     int
+	failed     int
+	skipped    int
+	files      map[string]pipeline.Event // Latest stage-started or progress event for files being processed
+	lines      int                       // Lines drawn by the last render, which are replaced by the next one
+}
+
+func newProgressDisplay(w io.Writer, inputs int) *progressDisplay {
+	return &progressDisplay{
+		w:          w,
+		started:    time.Now(),
+		inputs:     inputs,
+		inputFiles: make(map[int][2]int),
+		files:      make(map[string]pipeline.Event),
+	}
+}
+
+// Start redraws the display until Finish is called
+func (d *progressDisplay) Start() {
+	d.stop = make(chan struct{})
+	d.done = make(chan struct{})
+	d.render()
+
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(progressRenderInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				d.render()
+			}
+		}
+	}()
+}
+
+// HandleEvent updates the display with an event from the pipeline
+func (d *progressDisplay) HandleEvent(event pipeline.Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch event.Type {
+	case pipeline.EventInputStarted:
+		d.input = event.Input
+		d.inputIndex = event.InputIndex
+		d.splitting = false
+
+	case pipeline.EventStageStarted:
+		if event.Stage == pipeline.StageSplit {
+			d.splitting = true
+			return
+		}
+		d.files[event.File] = event
+		if event.Episodes > 0 {
+			counts := d.inputFiles[event.InputIndex]
+			counts[1] = event.Episodes
+			d.inputFiles[event.InputIndex] = counts
+		}
+
+	case pipeline.EventStageFinished:
+		if event.Stage == pipeline.StageSplit {
+			d.splitting = false
+		}
+
+	case pipeline.EventProgress:
+		if _, ok := d.files[event.File]; ok {
+			d.files[event.File] = event
+		}
+
+	case pipeline.EventFileFinished:
+		delete(d.files, event.File)
+		counts := d.inputFiles[event.InputIndex]
+		counts[0]++
+		counts[1] = event.Episodes
+		d.inputFiles[event.InputIndex] = counts
+
+		switch {
+		case event.Err == nil:
+			d.stored++
+		case isSkipped(event.Err):
+			d.skipped++
+		default:
+			d.failed++
+		}
+
+	case pipeline.EventInputFinished:
+		delete(d.inputFiles, event.InputIndex)
+		d.inputsDone++
+	}
+}
+
+// Finish stops redrawing, and prints a final summary below the display
+func (d *progressDisplay) Finish(results []pipeline.Result) {
+	close(d.stop)
+	<-d.done
+	d.render()
+
+	failed := countFailures(results)
+	fmt.Fprintf(d.w, "Finished in %s: %d of %d inputs succeeded, %d outputs stored",
+		time.Since(d.started).Round(time.Second), len(results)-failed, len(results), d.stored)
+	if d.failed > 0 {
+		fmt.Fprintf(d.w, ", %d files failed", d.failed)
+	}
+	if d.skipped > 0 {
+		fmt.Fprintf(d.w, ", %d files skipped", d.skipped)
+	}
+	fmt.Fprintln(d.w)
+}
+
+// render replaces the lines drawn last time with the current state
+func (d *progressDisplay) render() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lines := d.formatLines()
+	width := d.width()
+	var b strings.Builder
+	if d.lines > 0 {
+		// Move to the start of the first line, and clear everything below it
+		fmt.Fprintf(&b, "\x1b[%dA\r\x1b[J", d.lines)
+	}
+	for _, line := range lines {
+		// A line that wraps takes up more than one row, which would leave part of it behind on the next render
+		b.WriteString(truncateLine(line, width-1))
+		b.WriteString("\n")
+	}
+	io.WriteString(d.w, b.String())
+	d.lines = len(lines)
+}
+
+// width returns the number of columns lines can use without wrapping
+func (d *progressDisplay) width() int {
+	if f, ok := d.w.(*os.File); ok {
+		if width := terminalWidth(f); width > 0 {
+			return width
+		}
+	}
+	return defaultTerminalWidth
+}
+
+func (d *progressDisplay) formatLines() []string {
+	// Inputs count as done once every file has finished, so split inputs move the bar as each file finishes
+	progress := float64(d.inputsDone)
+	for _, counts := range d.inputFiles {
+		if counts[1] > 0 {
+			progress += float64(counts[0]) / float64(counts[1])
+		}
+	}
+	overall := 0.0
+	if d.inputs > 0 {
+		overall = progress / float64(d.inputs)
+	}
+
+	status := fmt.Sprintf("%d stored", d.stored)
+	if d.failed > 0 {
+		status += fmt.Sprintf(", %d failed", d.failed)
+	}
+	lines := []string{fmt.Sprintf("%s  %3.0f%%  inputs %d/%d  files %s  elapsed %s",
+		formatBar(overall), overall*100, d.inputsDone, d.inputs, status, time.Since(d.started).Round(time.Second))}
+
+	if d.input != "" && d.inputsDone < d.inputs {
+		line := fmt.Sprintf("input %d/%d: %s", d.inputIndex+1, d.inputs, d.input)
+		if d.splitting {
+			line += "  splitting"
+		}
+		lines = append(lines, line)
+	}
+
+	// Files are listed in the order they were queued
+	files := make([]pipeline.Event, 0, len(d.files))
+	for _, event := range d.files {
+		files = append(files, event)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].InputIndex != files[j].InputIndex {
+			return files[i].InputIndex < files[j].InputIndex
+		}
+		return files[i].Episode < files[j].Episode
+	})
+	for _, event := range files {
+		lines = append(lines, "  "+formatFileProgress(event))
+	}
+
+	return lines
+}
+
+// formatFileProgress describes the latest event for a file, with a progress bar while it's transcoding
+func formatFileProgress(event pipeline.Event) string {
+	name := filepath.Base(event.File)
+	if event.Episodes > 1 {
+		name = fmt.Sprintf("episode %d/%d  %s", event.Episode, event.Episodes, name)
+	}
+
+	line := fmt.Sprintf("%s  %s", name, stageActivities[event.Stage])
+	if event.Type != pipeline.EventProgress {
+		return line
+	}
+
+	progress := event.Progress
+	if fraction := progress.Fraction(); fraction >= 0 {
+		line += fmt.Sprintf("  %s  %3.0f%%", formatBar(fraction), fraction*100)
+	} else {
+		line += fmt.Sprintf("  frame %d", progress.Frame)
+	}
+	line += fmt.Sprintf("  %.1f fps", progress.FPS)
+	if progress.Speed > 0 {
+		line += fmt.Sprintf("  %.2fx", progress.Speed)
+	}
+	if eta := progress.ETA(); eta > 0 {
+		line += fmt.Sprintf("  ETA %s", eta.Round(time.Second))
+	}
+	return line
+}
+
+// truncateLine cuts line down to at most width characters
+func truncateLine(line string, width int) string {
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+	runes := []rune(line)
+	return string(runes[:max(0, width)])
+}
+
+// formatBar draws a progress bar for fraction, from 0 to 1
+func formatBar(fraction float64) string {
+	filled := int(fraction * progressBarWidth)
+	filled = max(0, min(progressBarWidth, filled))
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled) + "]"
+}
+
+// isSkipped reports whether err means a file was stopped or never processed, rather than failing
+func isSkipped(err error) bool {
+	return errors.Is(err, pipeline.ErrSkipped) || errors.Is(err, pipeline.ErrStopped) || errors.Is(err, context.Canceled)
+}
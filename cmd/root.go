@@ -2,7 +2,10 @@ package cmd
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"github.com/neptune-media/robin/pkg/naming"
 	"github.com/neptune-media/robin/pkg/pipeline"
 	"github.com/neptune-media/robin/pkg/tasks"
 	"github.com/spf13/pflag"
@@ -11,6 +14,7 @@ import (
 	"gopkg.in/yaml.v3"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -18,18 +22,41 @@ import (
 )
 
 const (
-	ARG_LOW_PRIORITY    = "low-priority"
-	ARG_OUTPUT          = "output"
-	ARG_PLEX            = "plex"
-	ARG_PLEX_EPISODE    = "plex-episode"
-	ARG_PLEX_MEDIA_TYPE = "plex-media-type"
-	ARG_PLEX_NAME       = "plex-name"
-	ARG_PLEX_SEASON     = "plex-season"
-	ARG_PLEX_YEAR       = "plex-year"
-	ARG_SKIP_ANALYZE    = "skip-analyze"
-	ARG_SPLIT           = "split"
-	ARG_TEMPLATE        = "template"
-	ARG_WORKDIR         = "work-dir"
+	ARG_CONTINUE_ON_ERROR         = "continue-on-error"
+	ARG_DOUBLE_EPISODE_LENGTH     = "double-episode-length"
+	ARG_DRY_RUN                   = "dry-run"
+	ARG_EXTRA_MAX_LENGTH          = "extra-max-length"
+	ARG_EXTRA_TYPE                = "extra-type"
+	ARG_GRACEFUL_STOP             = "graceful-stop"
+	ARG_LIBRARY                   = "library"
+	ARG_LOG_FILE                  = "log-file"
+	ARG_LOW_PRIORITY              = "low-priority"
+	ARG_MANIFEST                  = "manifest"
+	ARG_MANIFEST_SHA256SUMS       = "manifest-sha256sums"
+	ARG_NAME_TEMPLATE             = "name-template"
+	ARG_ON_COLLISION              = "on-collision"
+	ARG_OUTPUT                    = "output"
+	ARG_PARSE_FILENAMES           = "parse-filenames"
+	ARG_PLAN_FORMAT               = "plan-format"
+	ARG_PLEX                      = "plex"
+	ARG_PLEX_EDITION              = "plex-edition"
+	ARG_PLEX_EPISODE              = "plex-episode"
+	ARG_PLEX_MEDIA_TYPE           = "plex-media-type"
+	ARG_PLEX_NAME                 = "plex-name"
+	ARG_PLEX_SEASON               = "plex-season"
+	ARG_PLEX_YEAR                 = "plex-year"
+	ARG_PROGRESS                  = "progress"
+	ARG_RESUME                    = "resume"
+	ARG_SKIP_ANALYZE              = "skip-analyze"
+	ARG_SPACE_CHECK               = "space-check"
+	ARG_SPLIT                     = "split"
+	ARG_TEMPLATE                  = "template"
+	ARG_TRANSFER_MODE             = "transfer-mode"
+	ARG_VERIFY                    = "verify"
+	ARG_VERIFY_DURATION_TOLERANCE = "verify-duration-tolerance"
+	ARG_VERIFY_FULL_DECODE        = "verify-full-decode"
+	ARG_WORKDIR                   = "work-dir"
+	ARG_WORKERS                   = "workers"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -42,81 +69,114 @@ used to split multi-episode video files into single files, and
 transcode the resulting files.
 
 Optionally, the resulting files can also be renamed and stored in
-a folder structure expected by Plex, to make adding files to the
-media library a bit easier.`,
+a folder structure expected by Plex, Jellyfin, Emby or Kodi, to make
+adding files to the media library a bit easier.  The --plex-* flags
+describe the media for every library type.
+
+Defaults for every flag can be stored in a config file, along with
+named profiles that are selected with --profile.`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		return bindFlags(cmd)
+		if err := bindFlags(cmd); err != nil {
+			return err
+		}
+
+		// Problems with the config file aren't usage errors
+		cmd.SilenceUsage = true
+		return loadConfig()
 	},
-	Run: func(cmd *cobra.Command, args []string) {
-		// Setup logging
-		baseLogger, _ := newLogger(zap.DebugLevel)
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		// Arguments are valid at this point, so don't print usage for pipeline errors
+		cmd.SilenceUsage = true
+
+		// A dry run only probes inputs, so check how to print the plan before doing anything
+		dryRun := viper.GetBool(ARG_DRY_RUN)
+		planFormat := viper.GetString(ARG_PLAN_FORMAT)
+		if dryRun && planFormat != PLAN_FORMAT_TEXT && planFormat != PLAN_FORMAT_JSON {
+			return fmt.Errorf("unknown plan format: %s", planFormat)
+		}
+
+		showProgress, err := useProgressDisplay(viper.GetString(ARG_PROGRESS))
+		if err != nil {
+			return err
+		}
+		showProgress = showProgress && !dryRun
+
+		// Setup logging.  The progress display takes over the terminal, so logs go to a file instead.
+		var baseLogger *zap.Logger
+		if showProgress {
+			var logPath string
+			baseLogger, logPath, err = newFileLogger(viper.GetString(ARG_LOG_FILE))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Writing logs to %s\n", logPath)
+		} else {
+			baseLogger, _ = newLogger(zap.DebugLevel)
+		}
 		defer baseLogger.Sync()
 		logger := baseLogger.Sugar()
 		logger.Infow("Starting robin...")
 
-		// Create a temporary directory for storing intermediate files in
-		tempDir, cleanup, err := createTaskDirectory()
+		resume := viper.GetBool(ARG_RESUME) && !dryRun
+		pipe, tempDir, cleanup, err := newPipeline(logger, args, resume, dryRun, pipelineOverrides{})
 		if err != nil {
-			logger.Errorw("error while creating work dir", "err", err)
-			return
+			return err
 		}
-		defer cleanup(logger)
-
-		// Create the output directory to store results in
-		outputDir, err := createOutputDirectory()
-		if err != nil {
-			logger.Errorw("error while creating output dir", "err", err)
-			return
-		}
-
-		pipe := &pipeline.Pipeline{
-			Logger: logger,
-			Plex: pipeline.PlexOptions{
-				Enabled:   viper.GetBool(ARG_PLEX),
-				Episode:   viper.GetInt(ARG_PLEX_EPISODE),
-				MediaType: viper.GetString(ARG_PLEX_MEDIA_TYPE),
-				Name:      viper.GetString(ARG_PLEX_NAME),
-				Season:    viper.GetInt(ARG_PLEX_SEASON),
-				Year:      viper.GetInt(ARG_PLEX_YEAR),
-			},
-			OutputDir: outputDir,
-		}
-
-		if viper.GetBool(ARG_SPLIT) {
-			// Setup the split video task
-			pipe.Split = &tasks.SplitVideo{
-				Logger:           logger,
-				UseLowerPriority: viper.GetBool(ARG_LOW_PRIORITY),
-				WorkDir:          tempDir,
+		defer func() {
+			// Keep intermediate files around if this run can be resumed later
+			if resume && err != nil {
+				logger.Infow("keeping work dir for resuming", "dir", tempDir)
+				return
 			}
+			cleanup(logger)
+		}()
+
+		ctx, stopSignals := handleSignals(context.Background(), logger, viper.GetBool(ARG_GRACEFUL_STOP), pipe.Stop)
+		defer stopSignals()
+
+		if dryRun {
+			return writePlan(ctx, os.Stdout, pipe, args, planFormat)
 		}
 
-		if !viper.GetBool(ARG_SKIP_ANALYZE) {
-			// Setup the analyze task
-			pipe.Analyze = &tasks.AnalyzeVideo{
-				Logger:           logger,
-				UseLowerPriority: viper.GetBool(ARG_LOW_PRIORITY),
-				UseThreads:       true,
-			}
+		if err := checkSpace(ctx, logger, os.Stderr, pipe, args); err != nil {
+			return err
+		}
+
+		var display *progressDisplay
+		if showProgress {
+			display = newProgressDisplay(os.Stderr, len(args))
+			pipe.OnEvent = display.HandleEvent
+			display.Start()
 		}
 
-		// Setup the transcoding task
-		pipe.Transcode = &tasks.TranscodeVideo{
-			Logger:           logger,
-			UseLowerPriority: viper.GetBool(ARG_LOW_PRIORITY),
-			WorkDir:          tempDir,
+		results := pipe.DoAll(ctx, args)
+		if display != nil {
+			display.Finish(results)
 		}
-		if err := loadTemplates(pipe.Transcode); err != nil {
-			logger.Errorw("error while loading templates", "err", err)
-			return
+		for _, result := range results {
+			if result.Err != nil && !errors.Is(result.Err, pipeline.ErrSkipped) {
+				logger.Errorw("error while running pipeline", "input", result.Input, "err", result.Err)
+			}
 		}
 
-		for _, input := range args {
-			if _, err := pipe.Do(context.TODO(), input); err != nil {
-				logger.Errorw("error while running pipeline", "err", err)
-				return
+		// Outputs from a failed run are still worth recording
+		if viper.GetBool(ARG_MANIFEST) {
+			if err := writeManifest(logger, pipe.OutputDir, viper.GetStringSlice(ARG_TEMPLATE), results); err != nil {
+				logger.Errorw("error while writing manifest", "err", err)
+				return err
 			}
 		}
+
+		if !pipe.ContinueOnError {
+			return firstError(results)
+		}
+
+		printSummary(os.Stdout, results)
+		if failed := countFailures(results); failed > 0 {
+			return fmt.Errorf("%d of %d inputs failed", failed, len(results))
+		}
+
+		return nil
 	},
 }
 
@@ -133,18 +193,50 @@ func init() {
 	cobra.OnInitialize(initConfig)
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 
-	rootCmd.Flags().Bool(ARG_LOW_PRIORITY, false, "Runs subprocesses (codec/mkvmerge/etc) at a lower process priority")
-	rootCmd.Flags().String(ARG_OUTPUT, "robin-output", "Specifies a folder to copy final output to")
-	rootCmd.Flags().Bool(ARG_PLEX, false, "Enables renaming of output to plex recommendations")
-	rootCmd.Flags().Int(ARG_PLEX_EPISODE, 1, "Starting episode number for plex tv shows")
-	rootCmd.Flags().String(ARG_PLEX_MEDIA_TYPE, "", "Specifies if media is movie or tv show")
-	rootCmd.Flags().String(ARG_PLEX_NAME, "", "Movie or TV Show name")
-	rootCmd.Flags().Int(ARG_PLEX_SEASON, 1, "Season number for plex tv shows")
-	rootCmd.Flags().Int(ARG_PLEX_YEAR, 0, "Year of the plex media item")
-	rootCmd.Flags().Bool(ARG_SKIP_ANALYZE, false, "Skips analyzing the video before transcoding")
-	rootCmd.Flags().Bool(ARG_SPLIT, false, "Enables multi-episode file splitting before transcoding")
-	rootCmd.Flags().StringArray(ARG_TEMPLATE, nil, "Specifies a path to a template file")
-	rootCmd.Flags().String(ARG_WORKDIR, "", "Specifies a directory to use for scratch space")
+	rootCmd.PersistentFlags().String(ARG_CONFIG, "", "Specifies a config file (default is robin/config.yaml in the user config dir)")
+	rootCmd.PersistentFlags().String(ARG_PROFILE, "", "Selects a named profile from the config file")
+
+	rootCmd.Flags().Bool(ARG_DRY_RUN, false, "Probes inputs and prints the split points, transcoder commands and output paths, without encoding")
+	rootCmd.Flags().Bool(ARG_GRACEFUL_STOP, false, "On the first SIGINT/SIGTERM, finishes running episodes before stopping instead of aborting")
+	rootCmd.Flags().String(ARG_LOG_FILE, "", "File to write logs to while the progress display is shown (default is a new file under robin/logs in the user cache dir)")
+	rootCmd.Flags().Bool(ARG_MANIFEST, true, "Writes a manifest of every output with its SHA-256 digest to the output dir")
+	rootCmd.Flags().Bool(ARG_MANIFEST_SHA256SUMS, false, "Also writes the output digests in sha256sum format next to the manifest")
+	rootCmd.Flags().String(ARG_PLAN_FORMAT, PLAN_FORMAT_TEXT, "Format of the plan printed by --dry-run (text, json)")
+	rootCmd.Flags().String(ARG_PROGRESS, PROGRESS_AUTO, "When to replace log lines on stderr with a live progress display (auto, always, never), where auto shows it on a terminal")
+	rootCmd.Flags().Bool(ARG_RESUME, false, "Uses a work dir and journal tied to the inputs, so an interrupted run can skip work it already finished")
+	addPipelineFlags(rootCmd.Flags())
+}
+
+// addPipelineFlags adds the flags that configure a pipeline, for commands that run one
+func addPipelineFlags(flags *pflag.FlagSet) {
+	flags.Bool(ARG_CONTINUE_ON_ERROR, false, "Keeps processing remaining inputs and episodes after a failure, and prints a summary")
+	flags.Int(ARG_DOUBLE_EPISODE_LENGTH, 0, "Names split tv episodes at least this many minutes long as two episodes (s01e01-e02), 0 disables")
+	flags.Int(ARG_EXTRA_MAX_LENGTH, 0, "Names files shorter than this many minutes as extras instead of episodes or parts, 0 disables")
+	flags.String(ARG_EXTRA_TYPE, naming.ExtraFeaturette, fmt.Sprintf("Type of extra for short files (%s)", strings.Join(naming.ExtraTypes(), ", ")))
+	flags.String(ARG_LIBRARY, "", fmt.Sprintf("Enables renaming of output for a media library (%s)", strings.Join(naming.Libraries(), ", ")))
+	flags.Bool(ARG_LOW_PRIORITY, false, "Runs subprocesses (codec/mkvmerge/etc) at a lower process priority")
+	flags.String(ARG_NAME_TEMPLATE, "", "Names output using a Go text/template, instead of a library naming convention")
+	flags.String(ARG_ON_COLLISION, string(pipeline.CollisionFail), fmt.Sprintf("What to do when an output file already exists (%s)", strings.Join(pipeline.CollisionPolicies(), ", ")))
+	flags.String(ARG_OUTPUT, "robin-output", "Specifies a folder to copy final output to")
+	flags.Bool(ARG_PARSE_FILENAMES, false, "Infers show name, year, season and episode from each input filename, unless set by flags")
+	flags.Bool(ARG_PLEX, false, "Enables renaming of output to plex recommendations, same as --library plex")
+	flags.String(ARG_PLEX_EDITION, "", "Movie edition, like \"Director's Cut\"")
+	flags.Int(ARG_PLEX_EPISODE, 1, "Starting episode number for tv shows")
+	flags.String(ARG_PLEX_MEDIA_TYPE, "", "Specifies if media is movie or tv show")
+	flags.String(ARG_PLEX_NAME, "", "Movie or TV Show name")
+	flags.Int(ARG_PLEX_SEASON, 1, "Season number for tv shows")
+	flags.Int(ARG_PLEX_YEAR, 0, "Year of the media item")
+	flags.Bool(ARG_SKIP_ANALYZE, false, "Skips analyzing the video before transcoding")
+	flags.String(ARG_SPACE_CHECK, string(pipeline.SpaceCheckRefuse), fmt.Sprintf("What to do when the work dir or output dir looks too small, checked before starting and before each transcode (%s)", strings.Join(pipeline.SpaceChecks(), ", ")))
+	flags.Bool(ARG_SPLIT, false, "Enables multi-episode file splitting before transcoding")
+	flags.StringArray(ARG_TEMPLATE, nil, "Specifies a path to a template file")
+	flags.String(ARG_TRANSFER_MODE, string(pipeline.TransferCopy), fmt.Sprintf("How transcoded files are moved into the output dir (%s)", strings.Join(pipeline.TransferModes(), ", ")))
+	flags.Bool(ARG_VERIFY, false, "Probes each transcoded file and checks its streams, container duration and languages against the source before storing it")
+	flags.Int(ARG_VERIFY_DURATION_TOLERANCE, 2, "Allowed difference in seconds between source and output durations when verifying (at least 1)")
+	flags.Bool(ARG_VERIFY_FULL_DECODE, false, "Also decodes every frame of each transcoded file to check for corruption (implies --verify)")
+	flags.String(ARG_WORKDIR, "", "Specifies a directory to use for scratch space")
+	flags.Int(ARG_WORKERS, 1, "Number of episodes to analyze, transcode and copy concurrently, shared by all inputs rather than per input")
+	addSplitOptionFlags(flags)
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -167,6 +259,23 @@ func bindFlags(cmd *cobra.Command) error {
 	return nil
 }
 
+// getLibraryNamer returns the Namer selected by flags, or nil if outputs should keep their names
+func getLibraryNamer() (naming.Namer, error) {
+	if text := viper.GetString(ARG_NAME_TEMPLATE); text != "" {
+		return naming.NewTemplate(text)
+	}
+
+	library := viper.GetString(ARG_LIBRARY)
+	if library == "" && viper.GetBool(ARG_PLEX) {
+		library = "plex"
+	}
+
+	if library == "" {
+		return nil, nil
+	}
+	return naming.New(library)
+}
+
 func createOutputDirectory() (string, error) {
 	// Get the name of the output directory
 	name := viper.GetString(ARG_OUTPUT)
@@ -179,8 +288,14 @@ func createOutputDirectory() (string, error) {
 	return name, nil
 }
 
-func createTaskDirectory() (string, func(logger *zap.SugaredLogger), error) {
-	dir, err := os.MkdirTemp(viper.GetString(ARG_WORKDIR), "robin-")
+func createTaskDirectory(inputs []string, resumable bool) (string, func(logger *zap.SugaredLogger), error) {
+	var dir string
+	var err error
+	if resumable {
+		dir, err = createResumableTaskDirectory(inputs)
+	} else {
+		dir, err = os.MkdirTemp(viper.GetString(ARG_WORKDIR), "robin-")
+	}
 	if err != nil {
 		return "", nil, err
 	}
@@ -194,9 +309,33 @@ func createTaskDirectory() (string, func(logger *zap.SugaredLogger), error) {
 	return dir, f, nil
 }
 
-func loadTemplates(task *tasks.TranscodeVideo) error {
-	paths := viper.GetStringSlice(ARG_TEMPLATE)
+// createResumableTaskDirectory creates a work dir named after the inputs, so running again with the same inputs
+// finds the same directory
+func createResumableTaskDirectory(inputs []string) (string, error) {
+	hash := sha256.New()
+	for _, input := range inputs {
+		abs, err := filepath.Abs(input)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintln(hash, abs)
+	}
+
+	base := viper.GetString(ARG_WORKDIR)
+	if base == "" {
+		base = os.TempDir()
+	}
+
+	dir := filepath.Join(base, fmt.Sprintf("robin-resume-%x", hash.Sum(nil)[:6]))
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
 
+// loadTemplates reads the template files at paths into opts, in order, so later templates override earlier ones
+func loadTemplates(opts *tasks.TranscodeVideoOptions, paths []string) error {
 	for _, path := range paths {
 		// Read template
 		data, err := ioutil.ReadFile(path)
@@ -205,7 +344,7 @@ func loadTemplates(task *tasks.TranscodeVideo) error {
 		}
 
 		// Unpack into task options
-		if err := yaml.Unmarshal(data, &task.Options); err != nil {
+		if err := yaml.Unmarshal(data, opts); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/jobs"
+	"github.com/neptune-media/robin/pkg/naming"
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ARG_CONCURRENT_JOBS = "concurrent-jobs"
+	ARG_LISTEN          = "listen"
+	ARG_QUEUE_SIZE      = "queue-size"
+	ARG_TEMPLATE_DIR    = "template-dir"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Args:  cobra.NoArgs,
+	Short: "Runs a REST API that queues and runs jobs",
+	Long: `Runs a REST API for submitting jobs, checking on them, cancelling them
+and fetching their logs:
+
+  POST /jobs              {"inputs": [...], "templates": [...], "media": {...}}
+  GET  /jobs
+  GET  /jobs/{id}
+  POST /jobs/{id}/cancel
+  POST /jobs/{id}/retry
+  GET  /jobs/{id}/logs
+
+Jobs are stored in --job-db, so they survive restarts and can be managed
+with the jobs command.  Jobs that are running when the server stops are
+queued again, and start over when it's next started.
+
+Every job is run with the pipeline flags given to serve, or set in the config
+file.  Templates are named by their file name in --template-dir, and replace
+any --template flags.  Media details (name, type, year, season, episode and
+edition) replace the --plex-* flags whenever they're given, so "season": 0
+asks for specials.  Like a run from the command line, jobs check for free disk
+space before they start (see --space-check), and write a manifest when
+--manifest is set.
+
+While a job is running, GET /jobs/{id} includes its progress: the input and
+episode being processed, and the frame, fps and ETA of files being transcoded.
+
+Input paths are as seen by the server, and there's no authentication, so
+only listen on addresses that trusted clients can reach.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		baseLogger, _ := newLogger(zap.DebugLevel)
+		defer baseLogger.Sync()
+		logger := baseLogger.Sugar()
+
+		// Check the pipeline flags up front, rather than failing every job
+		if _, err := getLibraryNamer(); err != nil {
+			return err
+		}
+
+		store, err := openJobStore()
+		if err != nil {
+			return err
+		}
+
+		manager := &jobs.Manager{
+			Builder:   &serveBuilder{templateDir: viper.GetString(ARG_TEMPLATE_DIR)},
+			Logger:    logger,
+			QueueSize: viper.GetInt(ARG_QUEUE_SIZE),
+			Store:     store,
+			Workers:   viper.GetInt(ARG_CONCURRENT_JOBS),
+		}
+
+		server := &http.Server{
+			Addr:              viper.GetString(ARG_LISTEN),
+			Handler:           jobs.NewHandler(manager),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		ctx, stopSignals := handleSignals(context.Background(), logger, false, func() {})
+		defer stopSignals()
+
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			manager.Run(ctx)
+		}()
+
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+		}()
+
+		logger.Infow("listening for jobs", "addr", server.Addr)
+		err = server.ListenAndServe()
+		if !errors.Is(err, http.ErrServerClosed) {
+			stopSignals()
+			wg.Wait()
+			return err
+		}
+
+		// Running jobs are cancelled along with the context
+		wg.Wait()
+		return nil
+	},
+}
+
+// serveBuilder builds pipelines for jobs from the server's flags and config file
+type serveBuilder struct {
+	templateDir string
+	manifestMu  sync.Mutex
+}
+
+func (b *serveBuilder) Validate(spec jobs.Spec) error {
+	for _, input := range spec.Inputs {
+		info, err := os.Stat(input)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("input is not a file: %s", input)
+		}
+	}
+
+	if _, err := b.templatePaths(spec.Templates); err != nil {
+		return err
+	}
+
+	if spec.Media.Type != "" {
+		if _, err := naming.ParseMediaType(spec.Media.Type); err != nil {
+			return err
+		}
+	}
+
+	library, err := getLibraryNamer()
+	if err != nil {
+		return err
+	}
+	if library != nil && viper.GetString(ARG_NAME_TEMPLATE) == "" {
+		media, err := getMedia(library, spec.Media.Apply)
+		if err != nil {
+			return err
+		}
+		if err := media.Validate(); err != nil {
+			return fmt.Errorf("invalid media details: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Build checks for free disk space before a job runs, and writes its manifest afterwards, like a run from the command
+// line.  The table of filesystems that are short on space is only logged.
+func (b *serveBuilder) Build(ctx context.Context, spec jobs.Spec, logger *zap.SugaredLogger) (*pipeline.Pipeline, func(results []pipeline.Result) error, error) {
+	templates, err := b.templatePaths(spec.Templates)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pipe, _, cleanup, err := newPipeline(logger, spec.Inputs, false, false, pipelineOverrides{
+		Media:     spec.Media.Apply,
+		Templates: templates,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkSpace(ctx, logger, io.Discard, pipe, spec.Inputs); err != nil {
+		cleanup(logger)
+		return nil, nil, err
+	}
+
+	if len(templates) == 0 {
+		templates = viper.GetStringSlice(ARG_TEMPLATE)
+	}
+	finish := func(results []pipeline.Result) error {
+		defer cleanup(logger)
+		if !viper.GetBool(ARG_MANIFEST) {
+			return nil
+		}
+
+		// Jobs finishing at the same time can share an output dir, so each needs a manifest name of its own
+		b.manifestMu.Lock()
+		defer b.manifestMu.Unlock()
+		return writeManifest(logger, pipe.OutputDir, templates, results)
+	}
+	return pipe, finish, nil
+}
+
+// templatePaths returns the paths of templates named by a job, or nil to use the server's templates
+func (b *serveBuilder) templatePaths(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if b.templateDir == "" {
+		return nil, fmt.Errorf("templates can't be chosen without --%s", ARG_TEMPLATE_DIR)
+	}
+
+	paths := make([]string, len(names))
+	for i, name := range names {
+		// Names can't reach outside the template dir
+		if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+			return nil, fmt.Errorf("invalid template name: %q", name)
+		}
+
+		paths[i] = filepath.Join(b.templateDir, name)
+		if _, err := os.Stat(paths[i]); err != nil {
+			return nil, fmt.Errorf("unknown template: %s", name)
+		}
+	}
+
+	return paths, nil
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().Int(ARG_CONCURRENT_JOBS, 1, "Number of jobs to run at the same time")
+	serveCmd.Flags().String(ARG_JOB_DB, "", "Job database, which keeps jobs across restarts (default is robin/jobs.db in the user config dir)")
+	serveCmd.Flags().String(ARG_LISTEN, "localhost:8080", "Address to listen on for API requests")
+	serveCmd.Flags().Int(ARG_QUEUE_SIZE, 16, "Number of jobs that can wait to run before new jobs are refused")
+	serveCmd.Flags().String(ARG_TEMPLATE_DIR, "", "Directory holding the templates that jobs can choose from")
+	addPipelineFlags(serveCmd.Flags())
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleSignals returns a context that is cancelled on SIGINT or SIGTERM.  When graceful is set, the first signal
+// only calls stop, giving running work a chance to finish, and a second signal cancels the context.
+// The returned function must be called to stop listening for signals.
+func handleSignals(parent context.Context, logger *zap.SugaredLogger, graceful bool, stop func()) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		received := 0
+		for {
+			select {
+			case sig := <-signals:
+				received++
+				if graceful && received == 1 {
+					logger.Warnw("received signal, finishing running episodes before stopping (send again to abort)",
+						"signal", sig.String())
+					stop()
+					continue
+				}
+
+				logger.Warnw("received signal, aborting", "signal", sig.String())
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
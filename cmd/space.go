@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"go.uber.org/zap"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// checkSpace estimates the space a run needs before it starts, and reports filesystems that look too small
+func checkSpace(ctx context.Context, logger *zap.SugaredLogger, w io.Writer, pipe *pipeline.Pipeline, inputs []string) error {
+	if pipe.SpaceCheck == pipeline.SpaceCheckOff {
+		return nil
+	}
+
+	requirements, err := pipe.EstimateSpace(ctx, inputs)
+	if err != nil {
+		logger.Warnw("unable to check free disk space, skipping", "err", err)
+		return nil
+	}
+
+	insufficient := 0
+	for _, requirement := range requirements {
+		logger.Infow("estimated disk space",
+			"paths", requirement.Paths,
+			"required", pipeline.FormatBytes(requirement.Required),
+			"available", pipeline.FormatBytes(requirement.Available))
+		if !requirement.Sufficient() {
+			insufficient++
+		}
+	}
+	if insufficient == 0 {
+		return nil
+	}
+
+	writeSpaceReport(w, requirements)
+	if pipe.SpaceCheck == pipeline.SpaceCheckWarn {
+		logger.Warnw("continuing with low disk space", "filesystems", insufficient)
+		return nil
+	}
+	return fmt.Errorf("%w on %d filesystem(s), use --%s warn to run anyway", pipeline.ErrInsufficientSpace, insufficient, ARG_SPACE_CHECK)
+}
+
+// writeSpaceReport prints a table of the space needed on each filesystem
+func writeSpaceReport(w io.Writer, requirements []pipeline.SpaceRequirement) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "STATUS\tPATHS\tREQUIRED\tAVAILABLE")
+	for _, requirement := range requirements {
+		status := "OK"
+		if !requirement.Sufficient() {
+			status = "LOW"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", status, strings.Join(requirement.Paths, ", "),
+			pipeline.FormatBytes(requirement.Required), pipeline.FormatBytes(requirement.Available))
+	}
+}
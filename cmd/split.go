@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"github.com/neptune-media/robin/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ARG_PLAN                      = "plan"
+	ARG_SPLIT_ENDING_CHAPTER_TIME = "split-ending-chapter-time"
+	ARG_SPLIT_IGNORE_MISSING_END  = "split-ignore-missing-end"
+	ARG_SPLIT_MAX_EPISODE_LENGTH  = "split-max-episode-length"
+	ARG_SPLIT_MIN_CHAPTERS        = "split-min-chapters"
+	ARG_SPLIT_MIN_EPISODE_LENGTH  = "split-min-episode-length"
+	ARG_WRITE_PLAN                = "write-plan"
+)
+
+// splitCmd represents the split command
+var splitCmd = &cobra.Command{
+	Use:   "split [input files...]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Splits multi-episode video files without transcoding",
+	Long: `Splits multi-episode video files into single episodes, without
+transcoding them.
+
+Use --write-plan to only save the episodes found in each input to a
+YAML file.  After correcting any bad episode boundaries in that file,
+pass it back with --plan to split using the edited chapter ranges.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		splitOpts, err := getSplitVideoOptions()
+		if err != nil {
+			return err
+		}
+		collision, err := pipeline.ParseCollisionPolicy(viper.GetString(ARG_ON_COLLISION))
+		if err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+
+		baseLogger, _ := newLogger(zap.DebugLevel)
+		defer baseLogger.Sync()
+		logger := baseLogger.Sugar()
+
+		ctx, stopSignals := handleSignals(context.Background(), logger, false, func() {})
+		defer stopSignals()
+
+		task := &tasks.SplitVideo{
+			Logger:           logger,
+			Options:          splitOpts,
+			UseLowerPriority: viper.GetBool(ARG_LOW_PRIORITY),
+		}
+
+		if path := viper.GetString(ARG_WRITE_PLAN); path != "" {
+			return writeSplitPlans(ctx, logger, task, args, path)
+		}
+
+		var plans []*tasks.SplitPlan
+		if path := viper.GetString(ARG_PLAN); path != "" {
+			plans, err = tasks.ReadSplitPlans(path)
+			if err != nil {
+				logger.Errorw("error while reading split plan", "path", path, "err", err)
+				return err
+			}
+		}
+
+		outputDir, err := createOutputDirectory()
+		if err != nil {
+			logger.Errorw("error while creating output dir", "err", err)
+			return err
+		}
+
+		// Episodes are renamed into place the same way the pipeline stores outputs
+		place := &pipeline.Pipeline{Collision: collision, Logger: logger, Transfer: pipeline.TransferMove}
+
+		for _, input := range args {
+			task.SplitPlan = tasks.FindSplitPlan(plans, input)
+			if len(plans) > 0 && task.SplitPlan == nil {
+				logger.Warnw("no split plan found for input, using chapters instead", "input", input)
+			}
+
+			outputs, err := splitToDirectory(ctx, task, place, input, outputDir)
+			if err != nil {
+				logger.Errorw("error while splitting video", "input", input, "err", err)
+				return err
+			}
+			logger.Infow("split video", "input", input, "outputs", outputs)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(splitCmd)
+
+	splitCmd.Flags().Bool(ARG_LOW_PRIORITY, false, "Runs subprocesses (ffprobe/mkvmerge/etc) at a lower process priority")
+	splitCmd.Flags().String(ARG_ON_COLLISION, string(pipeline.CollisionFail), fmt.Sprintf("What to do when an output file already exists (%s)", strings.Join(pipeline.CollisionPolicies(), ", ")))
+	splitCmd.Flags().String(ARG_OUTPUT, "robin-output", "Specifies a folder to store split episodes in")
+	splitCmd.Flags().String(ARG_PLAN, "", "Specifies a split plan file to use instead of the chapter heuristics")
+	splitCmd.Flags().String(ARG_WRITE_PLAN, "", "Writes the episodes found in each input to a split plan file, without splitting")
+	addSplitOptionFlags(splitCmd.Flags())
+}
+
+// addSplitOptionFlags adds flags for the episode detection options, shared by every command that splits
+func addSplitOptionFlags(flags *pflag.FlagSet) {
+	flags.Int(ARG_SPLIT_ENDING_CHAPTER_TIME, 60, "Maximum length in seconds of the chapter that ends an episode")
+	flags.Bool(ARG_SPLIT_IGNORE_MISSING_END, false, "Allows the last episode to end without an ending chapter")
+	flags.Int(ARG_SPLIT_MAX_EPISODE_LENGTH, 0, "Fails if an episode is longer than this many minutes (0 disables the check)")
+	flags.Int(ARG_SPLIT_MIN_CHAPTERS, 2, "Minimum number of chapters in an episode")
+	flags.Int(ARG_SPLIT_MIN_EPISODE_LENGTH, 20, "Minimum length of an episode in minutes")
+}
+
+// getSplitVideoOptions reads the episode detection options from flags or config, and makes sure they're sane
+func getSplitVideoOptions() (tasks.SplitVideoOptions, error) {
+	opts := tasks.SplitVideoOptions{
+		EndingChapterTime:    viper.GetInt(ARG_SPLIT_ENDING_CHAPTER_TIME),
+		IgnoreMissingEnd:     viper.GetBool(ARG_SPLIT_IGNORE_MISSING_END),
+		MaximumEpisodeLength: viper.GetInt(ARG_SPLIT_MAX_EPISODE_LENGTH),
+		MinimumChapters:      viper.GetInt(ARG_SPLIT_MIN_CHAPTERS),
+		MinimumEpisodeLength: viper.GetInt(ARG_SPLIT_MIN_EPISODE_LENGTH),
+	}
+
+	if err := opts.Validate(); err != nil {
+		return opts, fmt.Errorf("invalid split options: %s", err)
+	}
+
+	return opts, nil
+}
+
+// writeSplitPlans finds the episodes in every input and saves them to a split plan file at path
+func writeSplitPlans(ctx context.Context, logger *zap.SugaredLogger, task *tasks.SplitVideo, inputs []string, path string) error {
+	plans := make([]*tasks.SplitPlan, 0, len(inputs))
+	for _, input := range inputs {
+		plan, err := task.Plan(ctx, input)
+		if err != nil {
+			logger.Errorw("error while reading episodes", "input", input, "err", err)
+			return err
+		}
+		plans = append(plans, plan)
+	}
+
+	if err := tasks.WriteSplitPlans(path, plans); err != nil {
+		logger.Errorw("error while writing split plan", "path", path, "err", err)
+		return err
+	}
+
+	logger.Infow("wrote split plan", "path", path, "inputs", len(plans))
+	return nil
+}
+
+// splitToDirectory splits input into a scratch directory inside outputDir, then places each episode in outputDir named
+// after the input, following the collision policy of place.  Keeping the scratch directory on the same filesystem
+// lets episodes be renamed, not copied.
+func splitToDirectory(ctx context.Context, task *tasks.SplitVideo, place *pipeline.Pipeline, input, outputDir string) ([]string, error) {
+	workDir, err := os.MkdirTemp(outputDir, ".robin-split-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	task.WorkDir = workDir
+	files, err := task.Do(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	basename := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	outputs := make([]string, len(files))
+	for i, file := range files {
+		dest := filepath.Join(outputDir, fmt.Sprintf("%s-%03d%s", basename, i+1, filepath.Ext(file)))
+		outputs[i], err = place.PlaceFile(file, dest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return outputs, nil
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"io"
+	"text/tabwriter"
+)
+
+func countFailures(results []pipeline.Result) int {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// firstError returns the first error that caused inputs to fail, ignoring inputs skipped because of it
+func firstError(results []pipeline.Result) error {
+	for _, result := range results {
+		if result.Err != nil && !errors.Is(result.Err, pipeline.ErrSkipped) {
+			return result.Err
+		}
+	}
+	return nil
+}
+
+// printSummary writes a table with the outcome of every input, and each failed stage
+func printSummary(w io.Writer, results []pipeline.Result) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "INPUT\tSTATUS\tSTAGE\tFILE\tDETAILS")
+
+	for _, result := range results {
+		if result.Err == nil {
+			fmt.Fprintf(tw, "%s\tok\t-\t-\t%d output(s)\n", result.Input, len(result.Outputs))
+			continue
+		}
+
+		stageErrs := pipeline.StageErrors(result.Err)
+		if len(stageErrs) == 0 {
+			fmt.Fprintf(tw, "%s\tfailed\t-\t-\t%v\n", result.Input, result.Err)
+			continue
+		}
+
+		for _, stageErr := range stageErrs {
+			file := stageErr.File
+			if file == "" {
+				file = "-"
+			}
+			fmt.Fprintf(tw, "%s\tfailed\t%s\t%s\t%v\n", result.Input, stageErr.Stage, file, stageErr.Err)
+		}
+	}
+
+	tw.Flush()
+}
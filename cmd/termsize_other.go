@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package cmd
+
+import "os"
+
+// terminalWidth is only supported on linux, macOS and FreeBSD
+func terminalWidth(f *os.File) int {
+	return 0
+}
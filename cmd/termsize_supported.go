@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd
+
+package cmd
+
+import (
+	"golang.org/x/sys/unix"
+	"os"
+)
+
+// terminalWidth returns the number of columns of the terminal f is attached to, or 0 if it isn't known
+func terminalWidth(f *os.File) int {
+	size, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return 0
+	}
+	return int(size.Col)
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"github.com/neptune-media/robin/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ARG_NAME_FORMAT = "name-format"
+)
+
+// transcodeCmd represents the transcode command
+var transcodeCmd = &cobra.Command{
+	Use:   "transcode [input files...]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Transcodes video files using templates, without splitting or renaming",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		baseLogger, _ := newLogger(zap.DebugLevel)
+		defer baseLogger.Sync()
+		logger := baseLogger.Sugar()
+
+		if err := tasks.ValidateOutputNameFormat(viper.GetString(ARG_NAME_FORMAT)); err != nil {
+			return err
+		}
+		collision, err := pipeline.ParseCollisionPolicy(viper.GetString(ARG_ON_COLLISION))
+		if err != nil {
+			return err
+		}
+
+		outputDir, err := createOutputDirectory()
+		if err != nil {
+			logger.Errorw("error while creating output dir", "err", err)
+			return err
+		}
+
+		var analyze *tasks.AnalyzeVideo
+		if !viper.GetBool(ARG_SKIP_ANALYZE) {
+			analyze = &tasks.AnalyzeVideo{
+				Logger:           logger,
+				UseLowerPriority: viper.GetBool(ARG_LOW_PRIORITY),
+				UseThreads:       true,
+			}
+		}
+
+		// Outputs are transcoded into a scratch directory inside the output dir, then renamed into place the same way
+		// the pipeline stores outputs, so a failed transcode never touches an existing file
+		transcode := &tasks.TranscodeVideo{
+			Logger:           logger,
+			OutputNameFormat: viper.GetString(ARG_NAME_FORMAT),
+			UseLowerPriority: viper.GetBool(ARG_LOW_PRIORITY),
+		}
+		if err := loadTemplates(&transcode.Options, viper.GetStringSlice(ARG_TEMPLATE)); err != nil {
+			logger.Errorw("error while loading templates", "err", err)
+			return err
+		}
+		if err := checkTranscodeOutputs(transcode, collision, args, outputDir); err != nil {
+			return err
+		}
+
+		workDir, err := os.MkdirTemp(outputDir, ".robin-transcode-")
+		if err != nil {
+			logger.Errorw("error while creating work dir", "err", err)
+			return err
+		}
+		defer os.RemoveAll(workDir)
+		transcode.WorkDir = workDir
+
+		place := &pipeline.Pipeline{Collision: collision, Logger: logger, Transfer: pipeline.TransferMove}
+
+		ctx, stopSignals := handleSignals(context.Background(), logger, false, func() {})
+		defer stopSignals()
+
+		failed := 0
+		for _, input := range args {
+			dest := filepath.Join(outputDir, filepath.Base(transcode.GetOutputFilename(input)))
+			if _, err := os.Stat(dest); err == nil && collision == pipeline.CollisionSkip {
+				logger.Infow("keeping existing output", "input", input, "output", dest)
+				continue
+			}
+
+			output, err := transcodeFile(ctx, analyze, transcode, place, input, dest)
+			if err != nil {
+				logger.Errorw("error while transcoding video", "input", input, "err", err)
+				failed++
+
+				// Nothing after this will succeed once cancelled
+				if ctx.Err() != nil {
+					break
+				}
+				continue
+			}
+			logger.Infow("transcoded video", "input", input, "output", output)
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d files failed to transcode", failed, len(args))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(transcodeCmd)
+
+	transcodeCmd.Flags().Bool(ARG_LOW_PRIORITY, false, "Runs subprocesses (codec/ffprobe/etc) at a lower process priority")
+	transcodeCmd.Flags().String(ARG_ON_COLLISION, string(pipeline.CollisionFail), fmt.Sprintf("What to do when an output file already exists (%s)", strings.Join(pipeline.CollisionPolicies(), ", ")))
+	transcodeCmd.Flags().String(ARG_NAME_FORMAT, "%s.mkv", "Format for output filenames, where %s is the input name without extension")
+	transcodeCmd.Flags().String(ARG_OUTPUT, "robin-output", "Specifies a folder to store transcoded files in")
+	transcodeCmd.Flags().Bool(ARG_SKIP_ANALYZE, false, "Skips analyzing the video before transcoding")
+	transcodeCmd.Flags().StringArray(ARG_TEMPLATE, nil, "Specifies a path to a template file")
+}
+
+// checkTranscodeOutputs refuses to start when two inputs would be written to the same output, or when an output already
+// exists and the collision policy would fail on it after transcoding
+func checkTranscodeOutputs(transcode *tasks.TranscodeVideo, collision pipeline.CollisionPolicy, inputs []string, outputDir string) error {
+	seen := make(map[string]string, len(inputs))
+	for _, input := range inputs {
+		dest := filepath.Join(outputDir, filepath.Base(transcode.GetOutputFilename(input)))
+		if other, ok := seen[dest]; ok && collision != pipeline.CollisionRenameSuffix {
+			return fmt.Errorf("%s and %s would both be written to %s, use --%s %s or a different --%s",
+				other, input, dest, ARG_ON_COLLISION, pipeline.CollisionRenameSuffix, ARG_NAME_FORMAT)
+		}
+		seen[dest] = input
+
+		if _, err := os.Stat(dest); err == nil && collision == pipeline.CollisionFail {
+			return fmt.Errorf("%w: %s", pipeline.ErrOutputExists, dest)
+		}
+	}
+	return nil
+}
+
+// transcodeFile transcodes input into the work dir of transcode, then places the result at dest
+func transcodeFile(ctx context.Context, analyze *tasks.AnalyzeVideo, transcode *tasks.TranscodeVideo, place *pipeline.Pipeline, input, dest string) (string, error) {
+	var results *tasks.AnalyzeResults
+	if analyze != nil {
+		var err error
+		results, err = analyze.Do(ctx, input)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	transcoded, err := transcode.Do(ctx, input, results)
+	if err != nil {
+		return "", err
+	}
+	return place.PlaceFile(transcoded, dest)
+}
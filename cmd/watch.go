@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/watch"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	ARG_EXTENSIONS = "extensions"
+	ARG_STABLE_FOR = "stable-for"
+
+	// jobOutputTail is how much of the output from a failed job is kept for its reason file
+	jobOutputTail = 8 * 1024
+)
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch [folder] [-- robin flags...]",
+	Short: "Processes video files as they are dropped into a folder",
+	Long: `Watches a folder for new video files, and runs robin on each of them
+once its size has stopped changing.  Flags after -- are passed to every run.
+
+Files dropped into a subfolder are run with the config profile of the same
+name, so an inbox with "anime" and "movies" subfolders can use different
+settings for each.  Files at the top level use --profile, if given.
+
+Processed files are moved into the done folder, and files that fail are
+moved into the failed folder along with a .reason.txt file.  Both keep the
+subfolder the file was dropped into.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			args = args[:dash]
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		baseLogger, _ := newLogger(zap.DebugLevel)
+		defer baseLogger.Sync()
+		logger := baseLogger.Sugar()
+
+		var flags []string
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			flags = args[dash:]
+		}
+
+		dir, err := filepath.Abs(args[0])
+		if err != nil {
+			return err
+		}
+
+		w := &watch.Watcher{
+			Dir:        dir,
+			Extensions: viper.GetStringSlice(ARG_EXTENSIONS),
+			Logger:     logger,
+			Run:        newWatchJobRunner(logger, flags),
+			StableFor:  time.Duration(viper.GetInt(ARG_STABLE_FOR)) * time.Second,
+		}
+
+		// The first signal lets the running job finish, and a second one interrupts it
+		ctx, stopSignals := handleSignals(context.Background(), logger, true, w.Stop)
+		defer stopSignals()
+
+		logger.Infow("watching for files", "dir", dir, "flags", flags)
+		err = w.Do(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	},
+}
+
+// newWatchJobRunner returns a function that runs robin on each file in a separate process, so every folder can use
+// its own profile without settings leaking between runs
+func newWatchJobRunner(logger *zap.SugaredLogger, flags []string) watch.RunFunc {
+	return func(ctx context.Context, job watch.Job) error {
+		executable, err := os.Executable()
+		if err != nil {
+			return err
+		}
+
+		var args []string
+		if config := viper.GetString(ARG_CONFIG); config != "" {
+			args = append(args, "--"+ARG_CONFIG, config)
+		}
+		profile := job.Profile
+		if profile == "" {
+			profile = viper.GetString(ARG_PROFILE)
+		}
+		if profile != "" {
+			args = append(args, "--"+ARG_PROFILE, profile)
+		}
+		args = append(args, flags...)
+		args = append(args, "--", job.Path)
+
+		// Keep the end of the output, which is where the reason for a failure shows up
+		output := &tailBuffer{limit: jobOutputTail}
+		child := exec.CommandContext(ctx, executable, args...)
+		child.Stdout = io.MultiWriter(os.Stdout, output)
+		child.Stderr = io.MultiWriter(os.Stderr, output)
+		// The child is kept out of our process group, so the first signal only stops the watcher from starting new
+		// jobs.  It's interrupted once ctx is cancelled by a second signal.
+		detachProcessGroup(child)
+		child.Cancel = func() error {
+			return child.Process.Signal(os.Interrupt)
+		}
+		child.WaitDelay = time.Minute
+
+		logger.Infow("running robin", "path", job.Path, "profile", profile, "args", args)
+		if err := child.Run(); err != nil {
+			return fmt.Errorf("robin %v: %w\n\nLast output:\n%s", args, err, output)
+		}
+
+		return nil
+	}
+}
+
+// tailBuffer keeps the last limit bytes written to it
+type tailBuffer struct {
+	buf   bytes.Buffer
+	limit int
+	mu    sync.Mutex // Stdout and stderr are copied concurrently
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Write(p)
+	if extra := b.buf.Len() - b.limit; extra > 0 {
+		b.buf.Next(extra)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().StringSlice(ARG_EXTENSIONS, []string{"mkv", "mp4", "m4v", "m2ts", "ts", "avi"}, "Extensions of files to process, other files are ignored")
+	watchCmd.Flags().Int(ARG_STABLE_FOR, 30, "Seconds a file's size must stay the same before it is processed")
+}
@@ -0,0 +1,190 @@
+package jobs
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// boltLockTimeout is how long to wait for another process to finish with the database
+const boltLockTimeout = 10 * time.Second
+
+var jobsBucket = []byte("jobs")
+
+// BoltStore keeps jobs in a bbolt database, so they survive restarts.  The database is only open while an operation
+// runs, so other processes, like the jobs command, can use it while a server is running.
+type BoltStore struct {
+	path string
+}
+
+// OpenBoltStore returns a store for the database at path, creating it if needed
+func OpenBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+
+	s := &BoltStore{path: path}
+	err := s.update(func(b *bolt.Bucket) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *BoltStore) Add(job Job) (Job, error) {
+	err := s.update(func(b *bolt.Bucket) error {
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		job.ID = strconv.FormatUint(seq, 10)
+		return putJob(b, job)
+	})
+	return job, err
+}
+
+func (s *BoltStore) Get(id string) (Job, error) {
+	var job Job
+	err := s.view(func(b *bolt.Bucket) error {
+		var err error
+		job, err = getJob(b, id)
+		return err
+	})
+	return job, err
+}
+
+func (s *BoltStore) List() ([]Job, error) {
+	var jobs []Job
+	err := s.view(func(b *bolt.Bucket) error {
+		// Keys are big endian sequence numbers, so they iterate in the order jobs were added
+		return b.ForEach(func(k, v []byte) error {
+			var job Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return fmt.Errorf("error while reading job %d: %v", binary.BigEndian.Uint64(k), err)
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	return jobs, err
+}
+
+func (s *BoltStore) Update(id string, fn func(job *Job) error) (Job, error) {
+	var job Job
+	var fnErr error
+	err := s.update(func(b *bolt.Bucket) error {
+		var err error
+		job, err = getJob(b, id)
+		if err != nil {
+			return err
+		}
+
+		// Errors from fn leave the job as it was, but aren't database errors
+		updated := job
+		if fnErr = fn(&updated); fnErr != nil {
+			return nil
+		}
+		job = updated
+		return putJob(b, job)
+	})
+	if err != nil {
+		return Job{}, err
+	}
+	return job, fnErr
+}
+
+func (s *BoltStore) Delete(id string) error {
+	return s.update(func(b *bolt.Bucket) error {
+		key, err := jobKey(id)
+		if err != nil {
+			return err
+		}
+		if b.Get(key) == nil {
+			return ErrNotFound
+		}
+		return b.Delete(key)
+	})
+}
+
+func (s *BoltStore) open(readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(s.path, 0600, &bolt.Options{ReadOnly: readOnly, Timeout: boltLockTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("error while opening job database %s: %v", s.path, err)
+	}
+	return db, nil
+}
+
+func (s *BoltStore) update(fn func(b *bolt.Bucket) error) error {
+	db, err := s.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(jobsBucket)
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+func (s *BoltStore) view(fn func(b *bolt.Bucket) error) error {
+	db, err := s.open(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(jobsBucket))
+	})
+}
+
+// jobKey returns the database key for a job ID
+func jobKey(id string) ([]byte, error) {
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key, nil
+}
+
+func getJob(b *bolt.Bucket, id string) (Job, error) {
+	key, err := jobKey(id)
+	if err != nil {
+		return Job{}, err
+	}
+
+	data := b.Get(key)
+	if data == nil {
+		return Job{}, ErrNotFound
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return Job{}, fmt.Errorf("error while reading job %s: %v", id, err)
+	}
+	return job, nil
+}
+
+func putJob(b *bolt.Bucket, job Job) error {
+	key, err := jobKey(job.ID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
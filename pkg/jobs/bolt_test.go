@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "robin", "jobs.db")
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("OpenBoltStore() error = %v", err)
+	}
+
+	for _, input := range []string{"disc1.mkv", "disc2.mkv", "disc3.mkv"} {
+		if _, err := store.Add(Job{Spec: Spec{Inputs: []string{input}}, Status: StatusQueued}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	updated, err := store.Update("2", func(job *Job) error {
+		job.Outputs = []string{"Show - s01e01.mkv"}
+		return nil
+	})
+	if err != nil || len(updated.Outputs) != 1 {
+		t.Fatalf("Update() got = %v, %v", updated.Outputs, err)
+	}
+	if _, err := store.Update("2", func(job *Job) error {
+		job.Status = StatusFailed
+		return ErrFinished
+	}); !errors.Is(err, ErrFinished) {
+		t.Errorf("Update() error = %v, want %v", err, ErrFinished)
+	}
+	if err := store.Delete("1"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+
+	// Jobs are read back from the file, as they would be after a restart
+	store, err = OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("OpenBoltStore() error = %v", err)
+	}
+	jobs, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != "2" || jobs[1].ID != "3" {
+		t.Fatalf("List() got = %v, want jobs 2 and 3", jobs)
+	}
+	if jobs[0].Status != StatusQueued || len(jobs[0].Outputs) != 1 {
+		t.Errorf("List() got job 2 = %+v, want the first update only", jobs[0])
+	}
+
+	for _, id := range []string{"1", "nope"} {
+		if _, err := store.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) error = %v, want %v", id, err, ErrNotFound)
+		}
+	}
+
+	if job, _ := store.Add(Job{}); job.ID != "4" {
+		t.Errorf("Add() got ID = %s, want IDs to keep counting after deletes", job.ID)
+	}
+}
@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// maxSpecSize limits the size of submitted jobs
+const maxSpecSize = 1 << 20
+
+// NewHandler returns the REST API for m:
+//
+//	POST /jobs              submits a job, from a JSON Spec
+//	GET  /jobs              lists every job
+//	GET  /jobs/{id}         returns a job, including its status and progress while it's running
+//	POST /jobs/{id}/cancel  cancels a queued or running job
+//	POST /jobs/{id}/retry   queues a finished job to run again
+//	GET  /jobs/{id}/logs    returns the latest log lines of a job, as newline delimited JSON
+func NewHandler(m *Manager) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /jobs", func(w http.ResponseWriter, r *http.Request) {
+		var spec Spec
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSpecSize))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&spec); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		job, err := m.Submit(spec)
+		if err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, job)
+	})
+
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		jobs, err := m.List()
+		if err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, jobs)
+	})
+
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, err := m.Get(r.PathValue("id"))
+		if err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	})
+
+	mux.HandleFunc("POST /jobs/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		job, err := m.Cancel(r.PathValue("id"))
+		if err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	})
+
+	mux.HandleFunc("POST /jobs/{id}/retry", func(w http.ResponseWriter, r *http.Request) {
+		job, err := m.Retry(r.PathValue("id"))
+		if err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	})
+
+	mux.HandleFunc("GET /jobs/{id}/logs", func(w http.ResponseWriter, r *http.Request) {
+		lines, err := m.Logs(r.PathValue("id"))
+		if err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, line := range lines {
+			w.Write([]byte(line + "\n"))
+		}
+	})
+
+	return mux
+}
+
+func statusForError(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidSpec):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrFinished), errors.Is(err, ErrNotFinished):
+		return http.StatusConflict
+	case errors.Is(err, ErrQueueFull):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
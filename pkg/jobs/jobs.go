@@ -0,0 +1,155 @@
+package jobs
+
+import (
+	"fmt"
+	"github.com/neptune-media/robin/pkg/naming"
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"strings"
+	"time"
+)
+
+// Status is where a job is in its lifecycle
+type Status string
+
+const (
+	StatusQueued      Status = "queued"
+	StatusStarting    Status = "starting" // Picked up by a worker, which is building its pipeline
+	StatusSplitting   Status = "splitting"
+	StatusAnalyzing   Status = "analyzing"
+	StatusTranscoding Status = "transcoding"
+	StatusVerifying   Status = "verifying"
+	StatusCopying     Status = "copying"
+	StatusDone        Status = "done"
+	StatusFailed      Status = "failed"
+	StatusCancelled   Status = "cancelled"
+)
+
+var statuses = []Status{
+	StatusQueued,
+	StatusStarting,
+	StatusSplitting,
+	StatusAnalyzing,
+	StatusTranscoding,
+	StatusVerifying,
+	StatusCopying,
+	StatusDone,
+	StatusFailed,
+	StatusCancelled,
+}
+
+var stageStatuses = map[pipeline.Stage]Status{
+	pipeline.StageSplit:     StatusSplitting,
+	pipeline.StageAnalyze:   StatusAnalyzing,
+	pipeline.StageTranscode: StatusTranscoding,
+	pipeline.StageVerify:    StatusVerifying,
+	pipeline.StageCopy:      StatusCopying,
+}
+
+// ParseStatus returns the Status named by s
+func ParseStatus(s string) (Status, error) {
+	for _, status := range statuses {
+		if string(status) == s {
+			return status, nil
+		}
+	}
+	return "", fmt.Errorf("unknown job status: %s (expected one of %s)", s, strings.Join(Statuses(), ", "))
+}
+
+// Statuses returns the names of every status
+func Statuses() []string {
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = string(status)
+	}
+	return names
+}
+
+// Finished reports whether a job with this status will only run again if it's retried
+func (s Status) Finished() bool {
+	return s == StatusDone || s == StatusFailed || s == StatusCancelled
+}
+
+// Active reports whether a job with this status is being run by a worker
+func (s Status) Active() bool {
+	return s != StatusQueued && !s.Finished()
+}
+
+// Spec describes the work for a job, as submitted to the server
+type Spec struct {
+	Inputs    []string `json:"inputs"`              // Paths of input files, as seen by the server
+	Templates []string `json:"templates,omitempty"` // Names of templates in the server's template dir, replacing its defaults
+	Media     Media    `json:"media"`
+}
+
+// Media describes the inputs of a job.  Fields that are set replace the server's defaults.  Numbers are pointers so
+// that 0 can be asked for, such as season 0 for specials.
+type Media struct {
+	Edition string `json:"edition,omitempty"`
+	Episode *int   `json:"episode,omitempty"` // Number of the first episode
+	Name    string `json:"name,omitempty"`
+	Season  *int   `json:"season,omitempty"`
+	Type    string `json:"type,omitempty"` // movie or tv
+	Year    *int   `json:"year,omitempty"`
+}
+
+// Apply returns defaults with every field that is set in m replaced
+func (m Media) Apply(defaults naming.Media) naming.Media {
+	media := defaults
+	if m.Edition != "" {
+		media.Edition = m.Edition
+	}
+	if m.Episode != nil {
+		media.Episode = *m.Episode
+	}
+	if m.Name != "" {
+		media.Name = m.Name
+	}
+	if m.Season != nil {
+		media.Season = *m.Season
+	}
+	if m.Type != "" {
+		media.Type = naming.MediaType(m.Type)
+	}
+	if m.Year != nil {
+		media.Year = *m.Year
+	}
+	return media
+}
+
+// Job is a submitted job, along with everything that has happened to it
+type Job struct {
+	ID       string       `json:"id"`
+	Spec     Spec         `json:"spec"`
+	Status   Status       `json:"status"`
+	File     string       `json:"file,omitempty"` // File the latest stage started for, while running
+	Created  time.Time    `json:"created"`
+	Started  *time.Time   `json:"started,omitempty"`
+	Finished *time.Time   `json:"finished,omitempty"`
+	Outputs  []string     `json:"outputs,omitempty"`
+	Error    string       `json:"error,omitempty"`
+	Errors   []StageError `json:"errors,omitempty"`   // Every stage that failed, when the pipeline got far enough to run them
+	History  []Transition `json:"history,omitempty"`  // Every status the job has had, oldest first
+	Progress *Progress    `json:"progress,omitempty"` // How far the job has got, while it's running
+}
+
+// StageError records a failed stage of a job
+type StageError struct {
+	Stage pipeline.Stage `json:"stage"`
+	Input string         `json:"input"`
+	File  string         `json:"file,omitempty"`
+	Error string         `json:"error"`
+}
+
+// Transition records when a job changed status
+type Transition struct {
+	Status Status    `json:"status"`
+	Time   time.Time `json:"time"`
+	File   string    `json:"file,omitempty"`
+}
+
+// setStatus changes the status of a job, recording the transition
+func (j *Job) setStatus(status Status, file string, now time.Time) {
+	j.Status = status
+	j.File = file
+	j.History = append(j.History, Transition{Status: status, Time: now, File: file})
+}
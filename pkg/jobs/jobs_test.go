@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"encoding/json"
+	"github.com/neptune-media/robin/pkg/naming"
+	"testing"
+)
+
+func TestMedia_Apply(t *testing.T) {
+	defaults := naming.Media{Name: "Show", Type: naming.MediaTypeTV, Season: 3, Episode: 7, Year: 2001}
+	tests := []struct {
+		name string
+		body string
+		want naming.Media
+	}{
+		{name: "empty", body: `{}`, want: defaults},
+		{
+			name: "specials",
+			body: `{"season": 0, "episode": 1}`,
+			want: naming.Media{Name: "Show", Type: naming.MediaTypeTV, Season: 0, Episode: 1, Year: 2001},
+		},
+		{
+			name: "everything",
+			body: `{"name": "Movie", "type": "movie", "year": 1999, "edition": "Extended", "season": 1, "episode": 2}`,
+			want: naming.Media{Name: "Movie", Type: naming.MediaTypeMovie, Season: 1, Episode: 2, Year: 1999, Edition: "Extended"},
+		},
+		{
+			name: "unknown year",
+			body: `{"year": 0}`,
+			want: naming.Media{Name: "Show", Type: naming.MediaTypeTV, Season: 3, Episode: 7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var media Media
+			if err := json.Unmarshal([]byte(tt.body), &media); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if got := media.Apply(defaults); got != tt.want {
+				t.Errorf("Apply() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
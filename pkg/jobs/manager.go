@@ -0,0 +1,565 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLogLines     = 1000
+	defaultPollInterval = 5 * time.Second
+	defaultQueueSize    = 16
+)
+
+var (
+	ErrFinished    = errors.New("job has already finished")
+	ErrInvalidSpec = errors.New("invalid job")
+	ErrNotFinished = errors.New("job hasn't finished")
+	ErrNotFound    = errors.New("job not found")
+	ErrQueueFull   = errors.New("job queue is full")
+
+	// errChanged is returned from updates when a job changed status since it was listed
+	errChanged = errors.New("job changed status")
+)
+
+// Builder creates the pipeline that runs a job
+type Builder interface {
+	// Validate checks a spec when it's submitted, so mistakes are reported before the job is queued
+	Validate(spec Spec) error
+
+	// Build returns the pipeline for a job, and a function that finishes up once it has run, such as by recording its
+	// results and cleaning up.  Errors from finishing up fail the job.
+	Build(ctx context.Context, spec Spec, logger *zap.SugaredLogger) (*pipeline.Pipeline, func(results []pipeline.Result) error, error)
+}
+
+// Manager queues submitted jobs in Store, and runs them with pipelines from Builder.  Jobs queued by other processes
+// sharing Store, such as retries, are picked up every PollInterval.
+type Manager struct {
+	Builder      Builder
+	LogLines     int // Log lines kept for each job.  Defaults to 1000
+	Logger       *zap.SugaredLogger
+	PollInterval time.Duration // How often to check Store for jobs queued elsewhere.  Defaults to 5s
+	QueueSize    int           // Jobs that can wait to run before more are refused.  Defaults to 16
+	Store        Store         // Holds every job.  Defaults to a MemoryStore
+	Workers      int           // Jobs that run at the same time.  Defaults to 1
+
+	initOnce sync.Once
+	mu       sync.Mutex // Serializes claiming, cancelling and queueing jobs
+	running  map[string]*run
+	logs     map[string]*logBuffer
+	progress map[string]*progressTracker // Progress of running jobs
+	wake     chan struct{}
+}
+
+// run tracks a job that's being run by this manager
+type run struct {
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// Run runs queued jobs until ctx is cancelled.  Running jobs are cancelled along with ctx, and queued again so they
+// start over on the next run.  Jobs left running by a manager that exited without cleaning up are marked as failed.
+func (m *Manager) Run(ctx context.Context) {
+	m.init()
+	m.recoverJobs()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < max(1, m.Workers); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// Submit queues a job for spec
+func (m *Manager) Submit(spec Spec) (Job, error) {
+	m.init()
+
+	if len(spec.Inputs) == 0 {
+		return Job{}, fmt.Errorf("%w: no inputs", ErrInvalidSpec)
+	}
+	if err := m.Builder.Validate(spec); err != nil {
+		return Job{}, fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkQueue(); err != nil {
+		return Job{}, err
+	}
+
+	job := Job{Spec: spec, Created: time.Now()}
+	job.setStatus(StatusQueued, "", job.Created)
+	job, err := m.Store.Add(job)
+	if err != nil {
+		return Job{}, err
+	}
+
+	m.Logger.Infow("queued job", "job", job.ID, "inputs", spec.Inputs)
+	m.signal()
+	return job, nil
+}
+
+// Get returns the job with the given id, along with its progress if it's running here
+func (m *Manager) Get(id string) (Job, error) {
+	m.init()
+	job, err := m.Store.Get(id)
+	if err != nil {
+		return job, err
+	}
+	job.Progress = m.getProgress(id)
+	return job, nil
+}
+
+// List returns every job, in the order they were submitted
+func (m *Manager) List() ([]Job, error) {
+	m.init()
+	jobs, err := m.Store.List()
+	for i := range jobs {
+		jobs[i].Progress = m.getProgress(jobs[i].ID)
+	}
+	return jobs, err
+}
+
+// Cancel stops a running job, or keeps a queued job from starting
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.init()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, err := m.Store.Get(id)
+	if err != nil {
+		return Job{}, err
+	}
+	if job.Status.Finished() {
+		return job, ErrFinished
+	}
+
+	if r, ok := m.running[id]; ok {
+		// The worker records the cancellation once the pipeline stops
+		r.cancelled = true
+		r.cancel()
+		m.Logger.Infow("cancelling job", "job", id)
+		return job, nil
+	}
+
+	// Either queued, or left running by a manager that's gone
+	job, err = m.Store.Update(id, func(job *Job) error {
+		if job.Status.Finished() {
+			return ErrFinished
+		}
+		now := time.Now()
+		job.Finished = &now
+		job.setStatus(StatusCancelled, "", now)
+		return nil
+	})
+	if err != nil {
+		return job, err
+	}
+
+	m.Logger.Infow("cancelled job", "job", id)
+	return job, nil
+}
+
+// Retry queues a finished job to run again from the start
+func (m *Manager) Retry(id string) (Job, error) {
+	m.init()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkQueue(); err != nil {
+		return Job{}, err
+	}
+
+	job, err := m.Store.Update(id, func(job *Job) error {
+		if !job.Status.Finished() {
+			return ErrNotFinished
+		}
+		job.Started = nil
+		job.Finished = nil
+		job.Outputs = nil
+		job.Error = ""
+		job.Errors = nil
+		job.setStatus(StatusQueued, "", time.Now())
+		return nil
+	})
+	if err != nil {
+		return job, err
+	}
+
+	m.Logger.Infow("queued job for retry", "job", id)
+	m.signal()
+	return job, nil
+}
+
+// Purge deletes finished jobs with one of the given statuses that finished before the given time, and returns them
+func (m *Manager) Purge(statuses []Status, before time.Time) ([]Job, error) {
+	m.init()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs, err := m.Store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var purged []Job
+	for _, job := range jobs {
+		if !job.Status.Finished() || !hasStatus(statuses, job.Status) {
+			continue
+		}
+		if job.Finished != nil && !job.Finished.Before(before) {
+			continue
+		}
+
+		if err := m.Store.Delete(job.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			return purged, err
+		}
+		delete(m.logs, job.ID)
+		purged = append(purged, job)
+	}
+
+	return purged, nil
+}
+
+// Logs returns the latest log lines of a job, as JSON.  Lines are only kept in memory, so jobs that ran before a
+// restart have none.
+func (m *Manager) Logs(id string) ([]string, error) {
+	m.init()
+	if _, err := m.Store.Get(id); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	logs, ok := m.logs[id]
+	m.mu.Unlock()
+
+	if !ok {
+		return []string{}, nil
+	}
+	return logs.Lines(), nil
+}
+
+func (m *Manager) init() {
+	m.initOnce.Do(func() {
+		if m.Store == nil {
+			m.Store = &MemoryStore{}
+		}
+		m.running = make(map[string]*run)
+		m.logs = make(map[string]*logBuffer)
+		m.progress = make(map[string]*progressTracker)
+		m.wake = make(chan struct{}, 1)
+	})
+}
+
+// recoverJobs marks jobs that were left running as failed, since their work dirs can't be trusted
+func (m *Manager) recoverJobs() {
+	jobs, err := m.Store.List()
+	if err != nil {
+		m.Logger.Errorw("error while listing jobs", "err", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if !job.Status.Active() {
+			continue
+		}
+
+		_, err := m.Store.Update(job.ID, func(job *Job) error {
+			if !job.Status.Active() {
+				return errChanged
+			}
+			now := time.Now()
+			job.Finished = &now
+			job.Error = fmt.Sprintf("interrupted by a restart while %s", job.Status)
+			job.setStatus(StatusFailed, "", now)
+			return nil
+		})
+		if err == nil {
+			m.Logger.Warnw("job was interrupted by a restart", "job", job.ID, "status", job.Status)
+		} else if !errors.Is(err, errChanged) {
+			m.Logger.Errorw("error while recovering job", "job", job.ID, "err", err)
+		}
+	}
+}
+
+// work runs queued jobs one at a time until ctx is cancelled
+func (m *Manager) work(ctx context.Context) {
+	pollInterval := m.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for ctx.Err() == nil {
+		if job, r, runCtx, ok := m.claim(ctx); ok {
+			m.runJob(runCtx, ctx, job, r)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-m.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim starts the oldest queued job, if there is one
+func (m *Manager) claim(ctx context.Context) (Job, *run, context.Context, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs, err := m.Store.List()
+	if err != nil {
+		m.Logger.Errorw("error while listing jobs", "err", err)
+		return Job{}, nil, nil, false
+	}
+
+	for _, queued := range jobs {
+		if queued.Status != StatusQueued {
+			continue
+		}
+
+		job, err := m.Store.Update(queued.ID, func(job *Job) error {
+			if job.Status != StatusQueued {
+				return errChanged
+			}
+			now := time.Now()
+			job.Started = &now
+			job.setStatus(StatusStarting, "", now)
+			return nil
+		})
+		if errors.Is(err, errChanged) {
+			continue
+		}
+		if err != nil {
+			m.Logger.Errorw("error while starting job", "job", queued.ID, "err", err)
+			return Job{}, nil, nil, false
+		}
+
+		runCtx, cancel := context.WithCancel(ctx)
+		r := &run{cancel: cancel}
+		m.running[job.ID] = r
+		m.logs[job.ID] = &logBuffer{limit: m.getLogLines()}
+		m.progress[job.ID] = newProgressTracker()
+
+		// Pass the wake up along, in case more jobs are waiting for other workers
+		m.signal()
+		return job, r, runCtx, true
+	}
+
+	return Job{}, nil, nil, false
+}
+
+func (m *Manager) runJob(ctx, parent context.Context, job Job, r *run) {
+	defer r.cancel()
+
+	logger := m.newJobLogger(job.ID)
+	logger.Infow("starting job", "inputs", job.Spec.Inputs)
+
+	pipe, finishUp, err := m.Builder.Build(ctx, job.Spec, logger)
+	if err != nil {
+		logger.Errorw("error while building pipeline", "err", err)
+		m.finish(parent, job.ID, r, nil, err)
+		return
+	}
+
+	m.mu.Lock()
+	tracker := m.progress[job.ID]
+	m.mu.Unlock()
+
+	pipe.OnEvent = func(event pipeline.Event) {
+		tracker.HandleEvent(event)
+		if event.Type != pipeline.EventStageStarted {
+			return
+		}
+		_, err := m.Store.Update(job.ID, func(job *Job) error {
+			job.setStatus(stageStatuses[event.Stage], event.File, event.Time)
+			return nil
+		})
+		if err != nil {
+			logger.Errorw("error while updating job", "err", err)
+		}
+	}
+
+	results := pipe.DoAll(ctx, job.Spec.Inputs)
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	if err := finishUp(results); err != nil {
+		logger.Errorw("error while finishing job", "err", err)
+		errs = append(errs, err)
+	}
+	m.finish(parent, job.ID, r, results, errors.Join(errs...))
+}
+
+// finish records the outcome of a job.  Jobs stopped because parent was cancelled are queued again.
+func (m *Manager) finish(parent context.Context, id string, r *run, results []pipeline.Result, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.running, id)
+	delete(m.progress, id)
+
+	job, updateErr := m.Store.Update(id, func(job *Job) error {
+		now := time.Now()
+		if err != nil && !r.cancelled && parent.Err() != nil {
+			job.Started = nil
+			job.setStatus(StatusQueued, "", now)
+			return nil
+		}
+
+		job.Finished = &now
+		for _, result := range results {
+			job.Outputs = append(job.Outputs, result.Outputs...)
+		}
+		if err != nil {
+			job.Error = err.Error()
+		}
+		for _, stageErr := range pipeline.StageErrors(err) {
+			job.Errors = append(job.Errors, StageError{
+				Stage: stageErr.Stage,
+				Input: stageErr.Input,
+				File:  stageErr.File,
+				Error: stageErr.Err.Error(),
+			})
+		}
+
+		switch {
+		case err == nil:
+			job.setStatus(StatusDone, "", now)
+		case r.cancelled:
+			job.setStatus(StatusCancelled, "", now)
+		default:
+			job.setStatus(StatusFailed, "", now)
+		}
+		return nil
+	})
+	if updateErr != nil {
+		m.Logger.Errorw("error while recording job", "job", id, "err", updateErr)
+		return
+	}
+
+	if job.Status == StatusQueued {
+		m.Logger.Infow("stopped job, which will run again on restart", "job", id)
+		return
+	}
+	m.Logger.Infow("finished job", "job", id, "status", job.Status, "outputs", len(job.Outputs))
+}
+
+// getProgress returns the progress of a job that's running here, or nil
+func (m *Manager) getProgress(id string) *Progress {
+	m.mu.Lock()
+	tracker, ok := m.progress[id]
+	m.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return tracker.Progress()
+}
+
+// checkQueue returns ErrQueueFull if no more jobs can be queued
+func (m *Manager) checkQueue() error {
+	jobs, err := m.Store.List()
+	if err != nil {
+		return err
+	}
+
+	queueSize := m.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	queued := 0
+	for _, job := range jobs {
+		if job.Status == StatusQueued {
+			queued++
+		}
+	}
+	if queued >= queueSize {
+		return ErrQueueFull
+	}
+	return nil
+}
+
+// signal wakes an idle worker, if there is one
+func (m *Manager) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// newJobLogger returns a logger that writes to the manager's logger, and keeps lines for the job's log
+func (m *Manager) newJobLogger(id string) *zap.SugaredLogger {
+	m.mu.Lock()
+	logs := m.logs[id]
+	m.mu.Unlock()
+
+	capture := zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(logs),
+		zapcore.DebugLevel,
+	)
+	core := zapcore.NewTee(m.Logger.Desugar().Core(), capture)
+	return zap.New(core, zap.AddCaller()).Sugar().With("job", id)
+}
+
+func (m *Manager) getLogLines() int {
+	if m.LogLines <= 0 {
+		return defaultLogLines
+	}
+	return m.LogLines
+}
+
+func hasStatus(statuses []Status, status Status) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// logBuffer keeps the last limit lines written to it
+type logBuffer struct {
+	lines []string
+	limit int
+	mu    sync.Mutex
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		b.lines = append(b.lines, line)
+	}
+	if extra := len(b.lines) - b.limit; extra > 0 {
+		// Appending copies the remaining lines to a new array once the old one fills up
+		b.lines = b.lines[extra:]
+	}
+	return len(p), nil
+}
+
+// Lines returns a copy of the lines in the buffer
+func (b *logBuffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.lines...)
+}
@@ -0,0 +1,200 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testBuilder fails every job, after blocking until the job is cancelled for inputs named "block"
+type testBuilder struct {
+	started chan string
+}
+
+func (b *testBuilder) Validate(spec Spec) error {
+	if spec.Media.Type == "bogus" {
+		return errors.New("unknown media type")
+	}
+	return nil
+}
+
+func (b *testBuilder) Build(ctx context.Context, spec Spec, logger *zap.SugaredLogger) (*pipeline.Pipeline, func(results []pipeline.Result) error, error) {
+	logger.Infow("building pipeline", "input", spec.Inputs[0])
+	if b.started != nil {
+		b.started <- spec.Inputs[0]
+	}
+	if spec.Inputs[0] == "block" {
+		<-ctx.Done()
+		return nil, nil, ctx.Err()
+	}
+	return nil, nil, errors.New("no encoder")
+}
+
+func waitForStatus(t *testing.T, m *Manager, id string, want Status) Job {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		job, err := m.Get(id)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if job.Status == want {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for job %s to be %s", id, want)
+	return Job{}
+}
+
+func TestManager(t *testing.T) {
+	builder := &testBuilder{started: make(chan string, 10)}
+	m := &Manager{Builder: builder, Logger: zap.NewNop().Sugar(), QueueSize: 1}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	blocked, err := m.Submit(Spec{Inputs: []string{"block"}})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	<-builder.started
+	waitForStatus(t, m, blocked.ID, StatusStarting)
+
+	queued, err := m.Submit(Spec{Inputs: []string{"queued"}})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if _, err := m.Submit(Spec{Inputs: []string{"overflow"}}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit() with a full queue error = %v, want %v", err, ErrQueueFull)
+	}
+	if _, err := m.Submit(Spec{}); !errors.Is(err, ErrInvalidSpec) {
+		t.Errorf("Submit() without inputs error = %v, want %v", err, ErrInvalidSpec)
+	}
+
+	if job, err := m.Cancel(queued.ID); err != nil || job.Status != StatusCancelled {
+		t.Errorf("Cancel() queued job got = %s, %v, want %s", job.Status, err, StatusCancelled)
+	}
+	if _, err := m.Cancel(blocked.ID); err != nil {
+		t.Errorf("Cancel() running job error = %v", err)
+	}
+	waitForStatus(t, m, blocked.ID, StatusCancelled)
+	if _, err := m.Cancel(blocked.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("Cancel() finished job error = %v, want %v", err, ErrFinished)
+	}
+
+	failed, err := m.Submit(Spec{Inputs: []string{"fail"}})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if input := <-builder.started; input != "fail" {
+		t.Errorf("started %s, want the cancelled job to be skipped", input)
+	}
+	job := waitForStatus(t, m, failed.ID, StatusFailed)
+	if job.Error != "no encoder" {
+		t.Errorf("failed job got error = %q, want %q", job.Error, "no encoder")
+	}
+
+	logs, _ := m.Logs(failed.ID)
+	if len(logs) == 0 || !strings.Contains(logs[0], `"job":"`+failed.ID+`"`) {
+		t.Errorf("Logs() got = %v, want lines for the job", logs)
+	}
+
+	if _, err := m.Retry(failed.ID); err != nil {
+		t.Errorf("Retry() error = %v", err)
+	}
+	if input := <-builder.started; input != "fail" {
+		t.Errorf("started %s after a retry, want fail", input)
+	}
+	job = waitForStatus(t, m, failed.ID, StatusFailed)
+	if got := len(job.History); got != 6 {
+		t.Errorf("retried job got %d transitions, want 6: %v", got, job.History)
+	}
+
+	if jobs, _ := m.List(); len(jobs) != 3 {
+		t.Errorf("List() got %d jobs, want 3", len(jobs))
+	}
+
+	purged, err := m.Purge([]Status{StatusCancelled}, time.Now())
+	if err != nil || len(purged) != 2 {
+		t.Errorf("Purge() got %d jobs, %v, want 2", len(purged), err)
+	}
+	if _, err := m.Get(blocked.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() purged job error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestManagerRecovery(t *testing.T) {
+	store := &MemoryStore{}
+	interrupted, _ := store.Add(Job{Spec: Spec{Inputs: []string{"fail"}}, Status: StatusTranscoding})
+	queued, _ := store.Add(Job{Spec: Spec{Inputs: []string{"fail"}}, Status: StatusQueued})
+
+	m := &Manager{Builder: &testBuilder{}, Logger: zap.NewNop().Sugar(), Store: store}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	job := waitForStatus(t, m, interrupted.ID, StatusFailed)
+	if !strings.Contains(job.Error, "interrupted") {
+		t.Errorf("interrupted job got error = %q, want it to mention the restart", job.Error)
+	}
+	job = waitForStatus(t, m, queued.ID, StatusFailed)
+	if job.Error != "no encoder" {
+		t.Errorf("queued job got error = %q, want it to run after the restart", job.Error)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m := &Manager{Builder: &testBuilder{}, Logger: zap.NewNop().Sugar()}
+	server := httptest.NewServer(NewHandler(m))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{name: "submit", method: http.MethodPost, path: "/jobs", body: `{"inputs":["/rips/disc1.mkv"],"media":{"name":"Show","type":"tv"}}`, want: http.StatusAccepted},
+		{name: "unknown field", method: http.MethodPost, path: "/jobs", body: `{"input":"/rips/disc1.mkv"}`, want: http.StatusBadRequest},
+		{name: "invalid spec", method: http.MethodPost, path: "/jobs", body: `{"inputs":["/rips/disc1.mkv"],"media":{"type":"bogus"}}`, want: http.StatusBadRequest},
+		{name: "list", method: http.MethodGet, path: "/jobs", want: http.StatusOK},
+		{name: "missing job", method: http.MethodGet, path: "/jobs/nope", want: http.StatusNotFound},
+		{name: "cancel missing job", method: http.MethodPost, path: "/jobs/nope/cancel", want: http.StatusNotFound},
+		{name: "retry queued job", method: http.MethodPost, path: "/jobs/1/retry", want: http.StatusConflict},
+		{name: "logs for missing job", method: http.MethodGet, path: "/jobs/nope/logs", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s %s got status = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+			}
+		})
+	}
+
+	jobs, _ := m.List()
+	if len(jobs) != 1 {
+		t.Fatalf("List() got %d jobs, want 1", len(jobs))
+	}
+	resp, err := http.Get(server.URL + "/jobs/" + jobs[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /jobs/{id} got status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
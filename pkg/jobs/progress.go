@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"sort"
+	"sync"
+)
+
+// Progress is how far a running job has got.  It's only kept in memory by the server running the job, so it's left
+// out of stored jobs.
+type Progress struct {
+	Input      string         `json:"input,omitempty"` // Latest input to start
+	InputIndex int            `json:"input_index"`     // Position of Input in the job's inputs, from 1
+	Inputs     int            `json:"inputs"`
+	Files      []FileProgress `json:"files,omitempty"` // Files being processed, in the order they were queued
+}
+
+// FileProgress is the latest progress of a file being processed
+type FileProgress struct {
+	File        string         `json:"file"`
+	Stage       pipeline.Stage `json:"stage"`
+	Episode     int            `json:"episode"`                // Position of File among the files of its input, from 1
+	Episodes    int            `json:"episodes,omitempty"`     // Number of files for its input, once it has been split
+	Frame       int            `json:"frame,omitempty"`        // Frames encoded so far, while transcoding
+	TotalFrames int            `json:"total_frames,omitempty"` // Frames in the file, if it was analyzed
+	FPS         float64        `json:"fps,omitempty"`
+	ETA         float64        `json:"eta_seconds,omitempty"` // Seconds left transcoding, if known
+}
+
+// progressTracker keeps the progress of a running job from its pipeline's events
+type progressTracker struct {
+	mu         sync.Mutex
+	input      string
+	inputIndex int
+	inputs     int
+	files      map[string]pipeline.Event // Latest stage-started or progress event for files being processed
+}
+
+func newProgressTracker() *progressTracker {
+	return &progressTracker{files: make(map[string]pipeline.Event)}
+}
+
+// HandleEvent updates the progress with an event from the pipeline
+func (t *progressTracker) HandleEvent(event pipeline.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch event.Type {
+	case pipeline.EventInputStarted:
+		t.input = event.Input
+		t.inputIndex = event.InputIndex
+		t.inputs = event.Inputs
+
+	case pipeline.EventStageStarted:
+		if event.Stage != pipeline.StageSplit {
+			t.files[event.File] = event
+		}
+
+	case pipeline.EventProgress:
+		if _, ok := t.files[event.File]; ok {
+			t.files[event.File] = event
+		}
+
+	case pipeline.EventFileFinished:
+		delete(t.files, event.File)
+	}
+}
+
+// Progress returns the latest progress
+func (t *progressTracker) Progress() *Progress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	progress := &Progress{Input: t.input, Inputs: t.inputs}
+	if t.input != "" {
+		progress.InputIndex = t.inputIndex + 1
+	}
+
+	events := make([]pipeline.Event, 0, len(t.files))
+	for _, event := range t.files {
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].InputIndex != events[j].InputIndex {
+			return events[i].InputIndex < events[j].InputIndex
+		}
+		return events[i].Episode < events[j].Episode
+	})
+
+	for _, event := range events {
+		file := FileProgress{
+			File:     event.File,
+			Stage:    event.Stage,
+			Episode:  event.Episode,
+			Episodes: event.Episodes,
+		}
+		if event.Type == pipeline.EventProgress {
+			file.Frame = event.Progress.Frame
+			file.TotalFrames = event.Progress.TotalFrames
+			file.FPS = event.Progress.FPS
+			file.ETA = event.Progress.ETA().Seconds()
+		}
+		progress.Files = append(progress.Files, file)
+	}
+
+	return progress
+}
@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"github.com/neptune-media/robin/pkg/tasks"
+	"reflect"
+	"testing"
+)
+
+func TestProgressTracker(t *testing.T) {
+	tracker := newProgressTracker()
+	events := []pipeline.Event{
+		{Type: pipeline.EventInputStarted, Input: "disc.mkv", InputIndex: 1, Inputs: 2},
+		{Type: pipeline.EventStageStarted, File: "episode-002.mkv", Episode: 2, Episodes: 3, Stage: pipeline.StageTranscode},
+		{Type: pipeline.EventStageStarted, File: "episode-001.mkv", Episode: 1, Episodes: 3, Stage: pipeline.StageTranscode},
+		{Type: pipeline.EventProgress, File: "episode-001.mkv", Episode: 1, Episodes: 3, Stage: pipeline.StageTranscode,
+			Progress: tasks.TranscodeProgress{Frame: 100, TotalFrames: 1100, FPS: 50}},
+		{Type: pipeline.EventStageStarted, File: "episode-003.mkv", Episode: 3, Episodes: 3, Stage: pipeline.StageCopy},
+		{Type: pipeline.EventFileFinished, File: "episode-003.mkv", Episode: 3, Episodes: 3},
+		// Progress for files that have finished is ignored
+		{Type: pipeline.EventProgress, File: "episode-003.mkv", Episode: 3, Episodes: 3, Stage: pipeline.StageTranscode},
+	}
+	for _, event := range events {
+		tracker.HandleEvent(event)
+	}
+
+	want := &Progress{
+		Input:      "disc.mkv",
+		InputIndex: 2,
+		Inputs:     2,
+		Files: []FileProgress{
+			{File: "episode-001.mkv", Stage: pipeline.StageTranscode, Episode: 1, Episodes: 3, Frame: 100, TotalFrames: 1100, FPS: 50, ETA: 20},
+			{File: "episode-002.mkv", Stage: pipeline.StageTranscode, Episode: 2, Episodes: 3},
+		},
+	}
+	if got := tracker.Progress(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Progress() got = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,104 @@
+package jobs
+
+import (
+	"strconv"
+	"sync"
+)
+
+// Store holds jobs for a Manager
+type Store interface {
+	// Add saves a new job, and returns it with its ID set
+	Add(job Job) (Job, error)
+
+	// Get returns the job with the given ID, or ErrNotFound
+	Get(id string) (Job, error)
+
+	// List returns every job, in the order they were added
+	List() ([]Job, error)
+
+	// Update changes a job with fn, and saves it unless fn returns an error.  Updates are atomic, even across
+	// processes sharing a persistent store.
+	Update(id string, fn func(job *Job) error) (Job, error)
+
+	// Delete removes the job with the given ID
+	Delete(id string) error
+}
+
+// MemoryStore keeps jobs in memory, so they are lost when the process exits
+type MemoryStore struct {
+	jobs  map[string]Job
+	order []string
+	next  uint64
+	mu    sync.Mutex
+}
+
+func (s *MemoryStore) Add(job Job) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.jobs == nil {
+		s.jobs = make(map[string]Job)
+	}
+	s.next++
+	job.ID = strconv.FormatUint(s.next, 10)
+	s.jobs[job.ID] = job
+	s.order = append(s.order, job.ID)
+	return job, nil
+}
+
+func (s *MemoryStore) Get(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return job, nil
+}
+
+func (s *MemoryStore) List() ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, 0, len(s.order))
+	for _, id := range s.order {
+		jobs = append(jobs, s.jobs[id])
+	}
+	return jobs, nil
+}
+
+func (s *MemoryStore) Update(id string, fn func(job *Job) error) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+
+	// Slices are copied, so a failed update can't change the stored job through them
+	job.History = append([]Transition(nil), job.History...)
+	if err := fn(&job); err != nil {
+		return s.jobs[id], err
+	}
+	s.jobs[id] = job
+	return job, nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.jobs, id)
+	for i, other := range s.order {
+		if other == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Manifest records every file produced by a run, with checksums so the outputs can be verified later
+type Manifest struct {
+	Version   string    `json:"version"`             // Version of robin that produced the outputs
+	Created   time.Time `json:"created"`             // When the run finished
+	OutputDir string    `json:"output_dir"`          // Output dir of the run.  Output paths are relative to it
+	Templates []File    `json:"templates,omitempty"` // Transcoding templates, in the order they were applied
+	Inputs    []Input   `json:"inputs"`
+}
+
+// Input records the files produced for a single input
+type Input struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Error    string    `json:"error,omitempty"` // Set if some of the input's episodes failed
+	Episodes []Episode `json:"episodes"`
+}
+
+// Episode records the output for a single file of an input
+type Episode struct {
+	File   string `json:"file"`             // Name of the split episode, or of the input if it wasn't split
+	Output *File  `json:"output,omitempty"` // Nil if the episode failed or was skipped, or its output couldn't be read
+	Error  string `json:"error,omitempty"`  // Set if the output couldn't be read to compute its digest
+}
+
+// File is a file along with its size and SHA-256 digest
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// New builds the manifest for results, which were stored in outputDir.  Outputs are only read to compute their digest
+// if the pipeline didn't compute it while copying them.  Outputs that can't be read are recorded with an error, so the
+// rest of the run still gets a manifest.
+func New(logger *zap.SugaredLogger, version, outputDir string, templates []string, results []pipeline.Result) (*Manifest, error) {
+	absOutputDir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{
+		Version:   version,
+		Created:   time.Now().UTC(),
+		OutputDir: absOutputDir,
+		Inputs:    make([]Input, 0, len(results)),
+	}
+
+	for _, template := range templates {
+		f, err := HashFile(template)
+		if err != nil {
+			return nil, err
+		}
+		m.Templates = append(m.Templates, f)
+	}
+
+	for _, result := range results {
+		input := Input{Path: result.Input, Episodes: make([]Episode, 0, len(result.Episodes))}
+		if abs, err := filepath.Abs(result.Input); err == nil {
+			input.Path = abs
+		}
+		if info, err := os.Stat(result.Input); err == nil {
+			input.Size = info.Size()
+		}
+		if result.Err != nil {
+			input.Error = result.Err.Error()
+		}
+
+		for _, episode := range result.Episodes {
+			e := Episode{File: filepath.Base(episode.File)}
+			if episode.Output != "" {
+				f, err := outputFile(logger, episode)
+				if err != nil {
+					logger.Warnw("error while computing checksum, leaving it out of the manifest", "file", episode.Output,
+						"err", err)
+					e.Error = err.Error()
+					input.Episodes = append(input.Episodes, e)
+					continue
+				}
+
+				// Relative paths keep the manifest valid if the library is moved
+				if rel, err := filepath.Rel(absOutputDir, f.Path); err == nil && !strings.HasPrefix(rel, "..") {
+					f.Path = filepath.ToSlash(rel)
+				}
+				e.Output = &f
+			}
+			input.Episodes = append(input.Episodes, e)
+		}
+
+		m.Inputs = append(m.Inputs, input)
+	}
+
+	return m, nil
+}
+
+// Read loads a manifest written by Write
+func Read(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("error while reading manifest %s: %v", path, err)
+	}
+	return m, nil
+}
+
+// Write saves the manifest as JSON
+func (m *Manifest) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// WriteSHA256Sums saves the output digests in the format read by sha256sum -c, relative to the output dir
+func (m *Manifest) WriteSHA256Sums(path string) error {
+	b := &strings.Builder{}
+	for _, output := range m.Outputs() {
+		fmt.Fprintf(b, "%s  %s\n", output.SHA256, output.Path)
+	}
+	return writeFileAtomic(path, []byte(b.String()))
+}
+
+// Outputs returns every output file in the manifest
+func (m *Manifest) Outputs() []File {
+	outputs := make([]File, 0)
+	for _, input := range m.Inputs {
+		for _, episode := range input.Episodes {
+			if episode.Output != nil {
+				outputs = append(outputs, *episode.Output)
+			}
+		}
+	}
+	return outputs
+}
+
+// outputFile returns the details of the output of episode, reusing its digest if the pipeline computed one
+func outputFile(logger *zap.SugaredLogger, episode pipeline.EpisodeResult) (File, error) {
+	if episode.SHA256 == "" {
+		logger.Infow("computing checksum", "file", episode.Output)
+		return HashFile(episode.Output)
+	}
+
+	abs, err := filepath.Abs(episode.Output)
+	if err != nil {
+		return File{}, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return File{}, err
+	}
+	return File{Path: abs, Size: info.Size(), SHA256: episode.SHA256}, nil
+}
+
+// HashFile returns the absolute path, size and SHA-256 digest of path
+func HashFile(path string) (File, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return File{}, err
+	}
+
+	f, err := os.Open(abs)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return File{}, err
+	}
+
+	return File{Path: abs, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// writeFileAtomic writes data to a temporary file first, so an interruption never leaves a truncated file behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,114 @@
+package manifest
+
+import (
+	"errors"
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManifest_Verify(t *testing.T) {
+	dir := t.TempDir()
+	outputDir := filepath.Join(dir, "output")
+	outputs := map[string]string{
+		"Show/Season 01/Show - s01e01.mkv": "episode one",
+		"Show/Season 01/Show - s01e02.mkv": "episode two",
+		"Show/Season 01/Show - s01e03.mkv": "episode three",
+	}
+	for name, contents := range outputs {
+		writeTestFile(t, filepath.Join(outputDir, name), contents)
+	}
+
+	results := []pipeline.Result{{
+		Input: filepath.Join(dir, "disc1.mkv"),
+		Episodes: []pipeline.EpisodeResult{
+			{File: "episode-001.mkv", Output: filepath.Join(outputDir, "Show/Season 01/Show - s01e01.mkv")},
+			{File: "episode-002.mkv", Output: filepath.Join(outputDir, "Show/Season 01/Show - s01e02.mkv")},
+			{File: "episode-003.mkv", Output: filepath.Join(outputDir, "Show/Season 01/Show - s01e03.mkv")},
+			{File: "episode-004.mkv"},
+		},
+		Err: errors.New("episode 4 failed"),
+	}}
+
+	m, err := New(zap.NewNop().Sugar(), "test", outputDir, nil, results)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// Round trip through disk, like verify-manifest would
+	path := filepath.Join(outputDir, "manifest.json")
+	if err := m.Write(path); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := m.WriteSHA256Sums(filepath.Join(outputDir, "SHA256SUMS")); err != nil {
+		t.Fatalf("WriteSHA256Sums() error = %v", err)
+	}
+	sums, _ := os.ReadFile(filepath.Join(outputDir, "SHA256SUMS"))
+	if !strings.Contains(string(sums), "  Show/Season 01/Show - s01e01.mkv\n") {
+		t.Errorf("WriteSHA256Sums() got = %q, want paths relative to the output dir", sums)
+	}
+
+	m, err = Read(path)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	// Damage the library, then move it somewhere else
+	writeTestFile(t, filepath.Join(outputDir, "Show/Season 01/Show - s01e02.mkv"), "episode 2!!")
+	os.Remove(filepath.Join(outputDir, "Show/Season 01/Show - s01e03.mkv"))
+	moved := filepath.Join(dir, "moved")
+	if err := os.Rename(outputDir, moved); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Status{StatusOK, StatusChecksumMismatch, StatusMissing}
+	checks := m.Verify(moved)
+	if len(checks) != len(want) {
+		t.Fatalf("Verify() got %d checks, want %d", len(checks), len(want))
+	}
+	for i := range want {
+		if checks[i].Status != want[i] {
+			t.Errorf("Verify() check %d got = %s, want %s", i+1, checks[i].Status, want[i])
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "Show - s01e01.mkv")
+	writeTestFile(t, output, "episode one")
+
+	results := []pipeline.Result{{
+		Input: filepath.Join(dir, "disc1.mkv"),
+		Episodes: []pipeline.EpisodeResult{
+			{File: "episode-001.mkv", Output: output, SHA256: "digest from copying"},
+			{File: "episode-002.mkv", Output: filepath.Join(dir, "missing.mkv")},
+		},
+	}}
+
+	m, err := New(zap.NewNop().Sugar(), "test", dir, nil, results)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	episodes := m.Inputs[0].Episodes
+	if got := episodes[0].Output; got == nil || got.SHA256 != "digest from copying" || got.Size != 11 {
+		t.Errorf("New() got output = %+v, want the digest from the pipeline", got)
+	}
+	if episodes[1].Output != nil || episodes[1].Error == "" {
+		t.Errorf("New() got = %+v, want an error for the missing output", episodes[1])
+	}
+}
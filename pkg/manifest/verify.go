@@ -0,0 +1,76 @@
+package manifest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Status is the outcome of checking a single file against the manifest
+type Status string
+
+const (
+	StatusOK               Status = "ok"
+	StatusMissing          Status = "missing"
+	StatusSizeMismatch     Status = "size mismatch"
+	StatusChecksumMismatch Status = "checksum mismatch"
+	StatusError            Status = "error"
+)
+
+// Check holds the outcome of checking a single output
+type Check struct {
+	File   File   // Output as recorded in the manifest
+	Path   string // Where the output was looked for
+	Status Status
+	Err    error // Set for StatusError
+}
+
+// Verify checks every output in the manifest against the files in dir, the directory that relative output paths are
+// resolved against.  The output dir recorded in the manifest is used when dir is empty.
+func (m *Manifest) Verify(dir string) []Check {
+	if dir == "" {
+		dir = m.OutputDir
+	}
+
+	outputs := m.Outputs()
+	checks := make([]Check, 0, len(outputs))
+	for _, output := range outputs {
+		path := filepath.FromSlash(output.Path)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		checks = append(checks, checkFile(output, path))
+	}
+
+	return checks
+}
+
+func checkFile(expected File, path string) Check {
+	check := Check{File: expected, Path: path}
+
+	// Comparing sizes first avoids reading files that are obviously wrong
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		check.Status = StatusMissing
+		return check
+	case err != nil:
+		check.Status, check.Err = StatusError, err
+		return check
+	case info.Size() != expected.Size:
+		check.Status = StatusSizeMismatch
+		return check
+	}
+
+	actual, err := HashFile(path)
+	switch {
+	case err != nil:
+		check.Status, check.Err = StatusError, err
+	case actual.SHA256 != expected.SHA256:
+		check.Status = StatusChecksumMismatch
+	default:
+		check.Status = StatusOK
+	}
+
+	return check
+}
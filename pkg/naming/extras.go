@@ -0,0 +1,62 @@
+package naming
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Extra types, for Media.Extra
+const (
+	ExtraBehindTheScenes = "behindthescenes"
+	ExtraDeletedScene    = "deleted"
+	ExtraFeaturette      = "featurette"
+	ExtraInterview       = "interview"
+	ExtraOther           = "other"
+	ExtraScene           = "scene"
+	ExtraShort           = "short"
+	ExtraTrailer         = "trailer"
+)
+
+// extraFolders maps each extra type to the local extras folder that Plex, Jellyfin and Emby look for
+var extraFolders = map[string]string{
+	ExtraBehindTheScenes: "Behind The Scenes",
+	ExtraDeletedScene:    "Deleted Scenes",
+	ExtraFeaturette:      "Featurettes",
+	ExtraInterview:       "Interviews",
+	ExtraOther:           "Other",
+	ExtraScene:           "Scenes",
+	ExtraShort:           "Shorts",
+	ExtraTrailer:         "Trailers",
+}
+
+// ExtraTypes returns every supported extra type
+func ExtraTypes() []string {
+	types := make([]string, 0, len(extraFolders))
+	for extra := range extraFolders {
+		types = append(types, extra)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ValidateExtra checks that extra is a supported extra type
+func ValidateExtra(extra string) error {
+	if _, ok := extraFolders[extra]; !ok {
+		return fmt.Errorf("unknown extra type: %s (expected one of %v)", extra, ExtraTypes())
+	}
+	return nil
+}
+
+// extraPath returns the path of an extra stored in folder, inside the movie or show directory dir
+func (m Media) extraPath(dir, folder string) (string, error) {
+	if folder == "" {
+		return "", fmt.Errorf("unknown extra type: %q", m.Extra)
+	}
+
+	name := m.EpisodeTitle
+	if name == "" {
+		name = fmt.Sprintf("%s-%02d", m.SourceFilename, m.SplitIndex)
+	}
+
+	return fmt.Sprintf("%s/%s/%s%s", dir, folder, name, m.extension()), nil
+}
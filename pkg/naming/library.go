@@ -0,0 +1,110 @@
+package naming
+
+import "fmt"
+
+// libraryNamer names files the way a media library expects to find them.  Formats are filled in with fmt.
+type libraryNamer struct {
+	edition       string            // Movie title with its edition, given the title and edition
+	editionFolder bool              // Puts editions in the folder name as well as the file name, so each edition gets its own folder
+	part          string            // Suffix for files split into parts, given the part number
+	episode       string            // Season and episode tag, given the season and episode numbers
+	episodeRange  string            // Added to the episode tag for files holding several episodes, given the last episode number
+	episodeName   string            // Episode file name, given the show title and episode tag
+	season        string            // Season folder, given the season number
+	specials      string            // Folder for season 0, or empty to use season
+	extras        map[string]string // Folders that replace the usual ones for some extra types
+	extrasFolder  string            // Single folder for every extra type, for libraries without a folder per type
+}
+
+var libraries = map[string]libraryNamer{
+	// https://emby.media/support/articles/Movie-Naming.html and https://emby.media/support/articles/TV-Naming.html
+	"emby": {
+		edition:      "%s - %s", // Editions are stored as alternate versions in the same folder
+		part:         " - part%d",
+		episode:      "S%02dE%02d",
+		episodeRange: "-E%02d",
+		episodeName:  "%s - %s",
+		season:       "Season %d",
+		specials:     "Specials",
+		extras:       map[string]string{ExtraOther: "Extras"}, // Emby has no folder for other extras, but picks up anything in "Extras"
+	},
+	// https://jellyfin.org/docs/general/server/media/movies and https://jellyfin.org/docs/general/server/media/shows
+	"jellyfin": {
+		edition:      "%s - %s", // Editions are stored as alternate versions in the same folder
+		part:         " - part%d",
+		episode:      "S%02dE%02d",
+		episodeRange: "-E%02d",
+		episodeName:  "%s %s",
+		season:       "Season %02d",
+	},
+	// https://kodi.wiki/view/Naming_video_files/Movies and https://kodi.wiki/view/Naming_video_files/TV_shows
+	"kodi": {
+		edition:      "%s - %s",
+		part:         " - part%d",
+		episode:      "S%02dE%02d",
+		episodeRange: "E%02d",
+		episodeName:  "%s %s",
+		season:       "Season %d",
+		specials:     "Specials",
+		extrasFolder: "Extras", // Kodi only knows a single extras folder, whatever the type of extra
+	},
+	// https://support.plex.tv/articles/naming-and-organizing-your-movie-media-files/,
+	// https://support.plex.tv/articles/naming-and-organizing-your-tv-show-files/ and
+	// https://support.plex.tv/articles/local-files-for-trailers-and-extras/
+	"plex": {
+		edition:       "%s {edition-%s}",
+		editionFolder: true,
+		part:          " - pt%d",
+		episode:       "s%02de%02d",
+		episodeRange:  "-e%02d",
+		episodeName:   "%s - %s",
+		season:        "Season %02d",
+	},
+}
+
+func (n libraryNamer) Path(media Media) (string, error) {
+	title := media.title()
+	if media.Type == MediaTypeMovie && media.Edition != "" && n.editionFolder {
+		title = fmt.Sprintf(n.edition, title, media.Edition)
+	}
+
+	if media.Extra != "" && media.Type.Valid() {
+		return media.extraPath(title, n.extraFolder(media.Extra))
+	}
+
+	part := media.partSuffix(n.part)
+	switch media.Type {
+	case MediaTypeMovie:
+		name := title
+		if media.Edition != "" && !n.editionFolder {
+			name = fmt.Sprintf(n.edition, title, media.Edition)
+		}
+
+		return fmt.Sprintf("%s/%s%s%s", title, name, part, media.extension()), nil
+	case MediaTypeTV:
+		season := fmt.Sprintf(n.season, media.Season)
+		if media.Season == 0 && n.specials != "" {
+			season = n.specials
+		}
+		name := fmt.Sprintf(n.episodeName, title, media.episodeTag(n.episode, n.episodeRange))
+
+		return fmt.Sprintf("%s/%s/%s%s%s", title, season, name, part, media.extension()), nil
+	}
+
+	return "", unknownTypeError(media)
+}
+
+// extraFolder returns the folder for extras of the given type, or nothing if the type is unknown
+func (n libraryNamer) extraFolder(extra string) string {
+	folder, ok := extraFolders[extra]
+	if !ok {
+		return ""
+	}
+	if n.extrasFolder != "" {
+		return n.extrasFolder
+	}
+	if replacement, ok := n.extras[extra]; ok {
+		return replacement
+	}
+	return folder
+}
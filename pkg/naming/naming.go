@@ -0,0 +1,155 @@
+package naming
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Namer builds the path of a file inside a media library, relative to the library root
+type Namer interface {
+	Path(media Media) (string, error)
+}
+
+// Media describes a single file to be stored in a media library
+type Media struct {
+	AudioCodec     string // Codec of the first audio stream
+	Edition        string // Movie edition, like "Director's Cut"
+	Episode        int    // Episode number, for tv shows
+	EpisodeCount   int    // Number of consecutive episodes in the file, starting at Episode.  0 or 1 for a single episode
+	EpisodeTitle   string // Title of the episode, if known
+	Extension      string // File extension, including the dot
+	Extra          string // Extra type, like "featurette", for bonus material stored with a movie or show
+	HDR            bool   // Set if the video stream is HDR
+	Name           string // Movie or tv show name
+	Part           int    // Part number, for files split into multiple parts.  0 if not split
+	Resolution     string // Resolution label of the video stream, like 1080p
+	Season         int    // Season number, for tv shows.  Season 0 holds specials
+	SourceFilename string // Name of the input file, without directory or extension
+	SplitIndex     int    // Position of the file in the split output, starting at 1
+	Type           MediaType
+	VideoCodec     string // Codec of the first video stream
+	Year           int    // Release year, or 0 if unknown
+}
+
+// MediaType is the kind of media stored in a library
+type MediaType string
+
+const (
+	MediaTypeMovie MediaType = "movie"
+	MediaTypeTV    MediaType = "tv"
+)
+
+// Media numbers outside these ranges are almost certainly typos
+const (
+	maxEpisode = 9999
+	maxSeason  = 9999 // Seasons may be numbered by year
+	minYear    = 1888 // Year of the oldest surviving film
+)
+
+// ParseMediaType returns the MediaType named by s
+func ParseMediaType(s string) (MediaType, error) {
+	mediaType := MediaType(strings.ToLower(strings.TrimSpace(s)))
+	if !mediaType.Valid() {
+		if s == "" {
+			return "", fmt.Errorf("media type is required (expected %s or %s)", MediaTypeMovie, MediaTypeTV)
+		}
+		return "", fmt.Errorf("unknown media type: %q (expected %s or %s)", s, MediaTypeMovie, MediaTypeTV)
+	}
+	return mediaType, nil
+}
+
+// Valid reports whether t is a known media type
+func (t MediaType) Valid() bool {
+	return t == MediaTypeMovie || t == MediaTypeTV
+}
+
+// Validate checks that media describes something a library can be named from.  An episode number of 0 is allowed,
+// since it's used to carry on numbering from a previous input.
+func (m Media) Validate() error {
+	if !m.Type.Valid() {
+		_, err := ParseMediaType(string(m.Type))
+		return err
+	}
+	if sanitizeComponent(m.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if strings.ContainsAny(m.Name, `/\`) {
+		return fmt.Errorf("name %q must not contain path separators", m.Name)
+	}
+	if m.Year != 0 && (m.Year < minYear || m.Year > time.Now().Year()+5) {
+		return fmt.Errorf("year %d is not plausible (expected %d-%d, or 0 if unknown)", m.Year, minYear, time.Now().Year()+5)
+	}
+	if m.Type == MediaTypeTV {
+		if m.Season < 0 || m.Season > maxSeason {
+			return fmt.Errorf("season %d is out of range (expected 0-%d, where 0 holds specials)", m.Season, maxSeason)
+		}
+		if m.Episode < 0 || m.Episode > maxEpisode {
+			return fmt.Errorf("episode %d is out of range (expected 0-%d)", m.Episode, maxEpisode)
+		}
+	}
+	if m.Extra != "" {
+		if err := ValidateExtra(m.Extra); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// New returns the Namer for the library with the given name
+func New(library string) (Namer, error) {
+	namer, ok := libraries[library]
+	if !ok {
+		return nil, fmt.Errorf("unknown library naming: %s (expected one of %v)", library, Libraries())
+	}
+	return namer, nil
+}
+
+// Libraries returns the names of every supported library
+func Libraries() []string {
+	names := make([]string, 0, len(libraries))
+	for name := range libraries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// title returns the name of the media, with the year if it's known
+func (m Media) title() string {
+	if m.Year > 0 {
+		return fmt.Sprintf("%s (%d)", m.Name, m.Year)
+	}
+	return m.Name
+}
+
+// partSuffix returns format filled in with the part number, or nothing if the media isn't split into parts
+func (m Media) partSuffix(format string) string {
+	if m.Part < 1 {
+		return ""
+	}
+	return fmt.Sprintf(format, m.Part)
+}
+
+// episodeTag formats the season and episode numbers with format, adding the last episode with rangeFormat when the
+// file holds several episodes
+func (m Media) episodeTag(format, rangeFormat string) string {
+	tag := fmt.Sprintf(format, m.Season, m.Episode)
+	if m.EpisodeCount > 1 {
+		tag += fmt.Sprintf(rangeFormat, m.Episode+m.EpisodeCount-1)
+	}
+	return tag
+}
+
+func (m Media) extension() string {
+	if m.Extension == "" {
+		return ".mkv"
+	}
+	return m.Extension
+}
+
+func unknownTypeError(media Media) error {
+	return fmt.Errorf("unknown media type: %q", media.Type)
+}
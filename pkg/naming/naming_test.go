@@ -0,0 +1,206 @@
+package naming
+
+import "testing"
+
+func TestNamer_Path(t *testing.T) {
+	show := Media{Name: "Show", Year: 2001, Season: 2, Episode: 5, Type: "tv"}
+	special := Media{Name: "Show", Season: 0, Episode: 1, Type: "tv"}
+	movie := Media{Name: "Movie", Year: 1999, Type: "movie", Extension: ".mp4"}
+	moviePart := Media{Name: "Movie", Year: 1999, Type: "movie", Part: 2}
+	double := Media{Name: "Show", Season: 1, Episode: 1, EpisodeCount: 2, Type: "tv"}
+	edition := Media{Name: "Movie", Year: 1999, Type: "movie", Edition: "Director's Cut"}
+	movieExtra := Media{Name: "Movie", Year: 1999, Type: "movie", Extra: ExtraFeaturette, SourceFilename: "disc", SplitIndex: 3}
+	showExtra := Media{Name: "Show", Type: "tv", Extra: ExtraBehindTheScenes, EpisodeTitle: "Making Of"}
+
+	tests := []struct {
+		library string
+		media   Media
+		want    string
+		wantErr bool
+	}{
+		{"plex", show, "Show (2001)/Season 02/Show (2001) - s02e05.mkv", false},
+		{"plex", special, "Show/Season 00/Show - s00e01.mkv", false},
+		{"plex", movie, "Movie (1999)/Movie (1999).mp4", false},
+		{"plex", moviePart, "Movie (1999)/Movie (1999) - pt2.mkv", false},
+		{"plex", double, "Show/Season 01/Show - s01e01-e02.mkv", false},
+		{"plex", edition, "Movie (1999) {edition-Director's Cut}/Movie (1999) {edition-Director's Cut}.mkv", false},
+		{"plex", movieExtra, "Movie (1999)/Featurettes/disc-03.mkv", false},
+		{"plex", showExtra, "Show/Behind The Scenes/Making Of.mkv", false},
+		{"plex", Media{Name: "Movie", Type: "movie", Extra: "bloopers"}, "", true},
+		{"plex", Media{Name: "Movie", Type: "movie", Edition: "Extended", Extra: ExtraTrailer, EpisodeTitle: "Teaser"}, "Movie {edition-Extended}/Trailers/Teaser.mkv", false},
+		{"plex", Media{Name: "Unknown"}, "", true},
+		{"jellyfin", show, "Show (2001)/Season 02/Show (2001) S02E05.mkv", false},
+		{"jellyfin", special, "Show/Season 00/Show S00E01.mkv", false},
+		{"jellyfin", moviePart, "Movie (1999)/Movie (1999) - part2.mkv", false},
+		{"jellyfin", double, "Show/Season 01/Show S01E01-E02.mkv", false},
+		{"jellyfin", edition, "Movie (1999)/Movie (1999) - Director's Cut.mkv", false},
+		{"emby", show, "Show (2001)/Season 2/Show (2001) - S02E05.mkv", false},
+		{"emby", special, "Show/Specials/Show - S00E01.mkv", false},
+		{"emby", Media{Name: "Show", Type: "tv", Extra: ExtraOther, EpisodeTitle: "Bloopers"}, "Show/Extras/Bloopers.mkv", false},
+		{"emby", movieExtra, "Movie (1999)/Featurettes/disc-03.mkv", false},
+		{"emby", edition, "Movie (1999)/Movie (1999) - Director's Cut.mkv", false},
+		{"kodi", show, "Show (2001)/Season 2/Show (2001) S02E05.mkv", false},
+		{"kodi", special, "Show/Specials/Show S00E01.mkv", false},
+		{"kodi", movie, "Movie (1999)/Movie (1999).mp4", false},
+		{"kodi", double, "Show/Season 1/Show S01E01E02.mkv", false},
+		{"kodi", movieExtra, "Movie (1999)/Extras/disc-03.mkv", false},
+		{"kodi", edition, "Movie (1999)/Movie (1999) - Director's Cut.mkv", false},
+		{"kodi", Media{Name: "Movie", Type: "movie", Extra: "bloopers"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.library+"/"+tt.want, func(t *testing.T) {
+			namer, err := New(tt.library)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			got, err := namer.Path(tt.media)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Path() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Path() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew_Unknown(t *testing.T) {
+	if _, err := New("itunes"); err == nil {
+		t.Errorf("New() expected an error for an unknown library")
+	}
+}
+
+func TestNewTemplate(t *testing.T) {
+	media := Media{
+		Name:       "Show: The Series",
+		Year:       2020,
+		Season:     1,
+		Episode:    3,
+		Resolution: "1080p",
+		VideoCodec: "hevc",
+		HDR:        true,
+		Type:       "tv",
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "adds extension",
+			text: `{{.Name}} ({{.Year}})/S{{printf "%02d" .Season}}/{{.Name}} - S{{.Season}}E{{.Episode}} [{{.Resolution}} {{.VideoCodec}}{{if .HDR}} HDR{{end}}]`,
+			want: "Show - The Series (2020)/S01/Show - The Series - S1E3 [1080p hevc HDR].mkv",
+		},
+		{
+			name: "keeps extension",
+			text: `{{.Name}}/../{{.Name}}.mkv`,
+			want: "Show - The Series/Show - The Series.mkv",
+		},
+		{
+			name:    "unknown field",
+			text:    `{{.Show}}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namer, err := NewTemplate(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got, err := namer.Path(media)
+			if err != nil {
+				t.Fatalf("Path() error = %v", err)
+			}
+			if got = SanitizePath(got); got != tt.want {
+				t.Errorf("SanitizePath(Path()) got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"Show/Season 01/Show - s01e01.mkv", "Show/Season 01/Show - s01e01.mkv"},
+		{`What If...?/What If...? - s01e01.mkv`, "What If/What If... - s01e01.mkv"},
+		{"../../etc/passwd", "etc/passwd"},
+		{`Back\Slash <1>.mkv`, "Back/Slash 1.mkv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := SanitizePath(tt.path); got != tt.want {
+				t.Errorf("SanitizePath() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeMedia(t *testing.T) {
+	media := SanitizeMedia(Media{
+		Type:         MediaTypeTV,
+		Name:         "AC/DC Live",
+		Season:       1,
+		Episode:      2,
+		EpisodeTitle: `Back\In Black`,
+		Extension:    ".mkv",
+	})
+	namer, err := NewTemplate(`{{.Name}}/{{.Name}} - {{.EpisodeTitle}}`)
+	if err != nil {
+		t.Fatalf("NewTemplate() error = %v", err)
+	}
+	got, err := namer.Path(media)
+	if err != nil {
+		t.Fatalf("Path() error = %v", err)
+	}
+	if want := "AC-DC Live/AC-DC Live - Back-In Black.mkv"; SanitizePath(got) != want {
+		t.Errorf("SanitizePath(Path()) got = %v, want %v", SanitizePath(got), want)
+	}
+}
+
+func TestMedia_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		media   Media
+		wantErr bool
+	}{
+		{"tv", Media{Name: "Show", Type: MediaTypeTV, Season: 1, Episode: 1, Year: 2001}, false},
+		{"special", Media{Name: "Show", Type: MediaTypeTV, Season: 0, Episode: 1}, false},
+		{"continued numbering", Media{Name: "Show", Type: MediaTypeTV, Season: 1}, false},
+		{"movie", Media{Name: "Movie", Type: MediaTypeMovie, Year: 1999}, false},
+		{"missing name", Media{Type: MediaTypeTV, Season: 1, Episode: 1}, true},
+		{"unusable name", Media{Name: " ?* ", Type: MediaTypeTV, Season: 1, Episode: 1}, true},
+		{"path in name", Media{Name: "AC/DC", Type: MediaTypeMovie}, true},
+		{"missing type", Media{Name: "Show"}, true},
+		{"typo in type", Media{Name: "Show", Type: "tvshow"}, true},
+		{"negative season", Media{Name: "Show", Type: MediaTypeTV, Season: -1, Episode: 1}, true},
+		{"negative episode", Media{Name: "Show", Type: MediaTypeTV, Season: 1, Episode: -1}, true},
+		{"implausible year", Media{Name: "Movie", Type: MediaTypeMovie, Year: 199}, true},
+		{"unknown extra", Media{Name: "Movie", Type: MediaTypeMovie, Extra: "bloopers"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.media.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseMediaType(t *testing.T) {
+	if got, err := ParseMediaType(" TV "); err != nil || got != MediaTypeTV {
+		t.Errorf("ParseMediaType() got = %v, %v, want %v", got, err, MediaTypeTV)
+	}
+	if _, err := ParseMediaType("series"); err == nil {
+		t.Errorf("ParseMediaType() expected an error for an unknown type")
+	}
+}
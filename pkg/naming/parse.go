@@ -0,0 +1,123 @@
+package naming
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParsedFilename holds the media details found in a filename
+type ParsedFilename struct {
+	Disc         int    // Disc number from a disc label, or 0
+	Episode      int    // Only valid if HasEpisode is set
+	EpisodeTitle string // Title following the episode number, if any
+	HasEpisode   bool
+	HasSeason    bool
+	Name         string // Show name, or empty if not found
+	Pattern      string // Name of the pattern that matched
+	Season       int    // Only valid if HasSeason is set
+	Title        int    // MakeMKV title number, or -1
+	Year         int    // Year, or 0 if not found
+}
+
+var (
+	// MakeMKV names files after the disc label, with a title suffix like "_t00"
+	makemkvTitlePattern = regexp.MustCompile(`(?i)^(.*?)_t(\d{2})$`)
+
+	// Show.Name.2019.S02E05.Episode.Title.1080p
+	scenePattern = regexp.MustCompile(`(?i)^(.+?)[ ._-]+(?:\(?((?:19|20)\d{2})\)?[ ._-]+)?s(\d{1,2})[ ._-]?e(\d{1,3})(.*)$`)
+
+	// Show - 2x05 - Episode Title
+	crossPattern = regexp.MustCompile(`(?i)^(.+?)[ ._-]+(?:\(?((?:19|20)\d{2})\)?[ ._-]+)?(\d{1,2})x(\d{2,3})(.*)$`)
+
+	// SHOW_S1_D2 or SHOW_SEASON_1_DISC_2
+	discLabelPattern = regexp.MustCompile(`(?i)^(.+?)[ ._-]+s(?:eason)?[ ._-]?(\d{1,2})[ ._-]*d(?:is[ck])?[ ._-]?(\d{1,2})$`)
+
+	// Release tags that end an episode title
+	releaseTagPattern = regexp.MustCompile(`(?i)(^|[ ._-])(\d{3,4}p|web|webrip|web-dl|bluray|bdrip|brrip|hdtv|dvdrip|remux|x264|x265|h264|h265|hevc|proper|repack)([ ._-]|$)`)
+
+	separatorPattern = regexp.MustCompile(`[._\s]+`)
+)
+
+// ParseFilename finds the show name, season, episode and other details in the name of a file.
+// The second return value is false if no pattern matched.
+func ParseFilename(path string) (ParsedFilename, bool) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	parsed := ParsedFilename{Title: -1}
+
+	if m := scenePattern.FindStringSubmatch(name); m != nil {
+		parsed.Pattern = "scene"
+		parsed.setShow(m[1], m[2], m[3], m[4])
+		parsed.EpisodeTitle = parseEpisodeTitle(m[5])
+		return parsed, true
+	}
+
+	if m := crossPattern.FindStringSubmatch(name); m != nil {
+		parsed.Pattern = "season-x-episode"
+		parsed.setShow(m[1], m[2], m[3], m[4])
+		parsed.EpisodeTitle = parseEpisodeTitle(m[5])
+		return parsed, true
+	}
+
+	// Disc labels may have a MakeMKV title suffix
+	matched := false
+	if m := makemkvTitlePattern.FindStringSubmatch(name); m != nil {
+		parsed.Pattern = "makemkv"
+		parsed.Title, _ = strconv.Atoi(m[2])
+		name = m[1]
+		matched = true
+	}
+
+	if m := discLabelPattern.FindStringSubmatch(name); m != nil {
+		parsed.Pattern = "disc-label"
+		parsed.Name = cleanName(m[1])
+		parsed.Season, _ = strconv.Atoi(m[2])
+		parsed.HasSeason = true
+		parsed.Disc, _ = strconv.Atoi(m[3])
+		return parsed, true
+	}
+
+	// MakeMKV's default "title_t00" doesn't say anything about the show
+	if matched && !strings.EqualFold(name, "title") {
+		parsed.Name = cleanName(name)
+	}
+
+	return parsed, matched
+}
+
+func (p *ParsedFilename) setShow(name, year, season, episode string) {
+	p.Name = cleanName(name)
+	p.Year, _ = strconv.Atoi(year)
+	p.Season, _ = strconv.Atoi(season)
+	p.Episode, _ = strconv.Atoi(episode)
+	p.HasSeason = true
+	p.HasEpisode = true
+}
+
+// parseEpisodeTitle returns the text following an episode number, up to the first release tag
+func parseEpisodeTitle(rest string) string {
+	if loc := releaseTagPattern.FindStringIndex(rest); loc != nil {
+		rest = rest[:loc[0]]
+	}
+	return cleanName(rest)
+}
+
+// cleanName turns separators into spaces, and fixes the case of names that are all uppercase, like disc labels
+func cleanName(name string) string {
+	name = separatorPattern.ReplaceAllString(name, " ")
+	name = strings.Trim(name, " -")
+
+	if name != strings.ToUpper(name) {
+		return name
+	}
+
+	words := strings.Fields(strings.ToLower(name))
+	for i, word := range words {
+		first, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToUpper(first)) + word[size:]
+	}
+	return strings.Join(words, " ")
+}
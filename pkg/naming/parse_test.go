@@ -0,0 +1,69 @@
+package naming
+
+import "testing"
+
+func TestParseFilename(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   ParsedFilename
+		wantOk bool
+	}{
+		{
+			path: "/rips/Show.Name.S02E05.The.Episode.1080p.WEB-DL.x264-GRP.mkv",
+			want: ParsedFilename{Name: "Show Name", Season: 2, Episode: 5, HasSeason: true, HasEpisode: true,
+				EpisodeTitle: "The Episode", Pattern: "scene", Title: -1},
+			wantOk: true,
+		},
+		{
+			path: "Show.Name.2019.s01e10.mkv",
+			want: ParsedFilename{Name: "Show Name", Year: 2019, Season: 1, Episode: 10, HasSeason: true,
+				HasEpisode: true, Pattern: "scene", Title: -1},
+			wantOk: true,
+		},
+		{
+			path: "Show - 2x05 - Episode Title.mkv",
+			want: ParsedFilename{Name: "Show", Season: 2, Episode: 5, HasSeason: true, HasEpisode: true,
+				EpisodeTitle: "Episode Title", Pattern: "season-x-episode", Title: -1},
+			wantOk: true,
+		},
+		{
+			path: "SHOW_NAME_S1_D2_t03.mkv",
+			want: ParsedFilename{Name: "Show Name", Season: 1, HasSeason: true, Disc: 2, Pattern: "disc-label",
+				Title: 3},
+			wantOk: true,
+		},
+		{
+			path: "ÉLITE_S1_D1.mkv",
+			want: ParsedFilename{Name: "Élite", Season: 1, HasSeason: true, Disc: 1, Pattern: "disc-label",
+				Title: -1},
+			wantOk: true,
+		},
+		{
+			path: "SHOW_SEASON_3_DISC_1.mkv",
+			want: ParsedFilename{Name: "Show", Season: 3, HasSeason: true, Disc: 1, Pattern: "disc-label",
+				Title: -1},
+			wantOk: true,
+		},
+		{
+			path:   "title_t00.mkv",
+			want:   ParsedFilename{Pattern: "makemkv", Title: 0},
+			wantOk: true,
+		},
+		{
+			path:   "home movie.mkv",
+			want:   ParsedFilename{Title: -1},
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := ParseFilename(tt.path)
+			if ok != tt.wantOk {
+				t.Errorf("ParseFilename() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFilename() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
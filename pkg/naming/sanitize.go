@@ -0,0 +1,71 @@
+package naming
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SanitizePath makes every component of a slash separated path safe to use as a file name on Windows, macOS and
+// Linux.  The result can't escape the directory it's joined to, since "." and ".." components are removed.
+func SanitizePath(path string) string {
+	components := strings.Split(strings.ReplaceAll(path, "\\", "/"), "/")
+	sanitized := make([]string, 0, len(components))
+	for _, component := range components {
+		component = sanitizeComponent(component)
+		if component != "" {
+			sanitized = append(sanitized, component)
+		}
+	}
+
+	return strings.Join(sanitized, "/")
+}
+
+// SanitizeMedia returns media with path separators replaced in every field that's used inside a path component, so
+// a name like "AC/DC Live" can't add directories to the library path
+func SanitizeMedia(media Media) Media {
+	fields := []*string{
+		&media.AudioCodec, &media.Edition, &media.EpisodeTitle, &media.Extra, &media.Name, &media.Resolution,
+		&media.SourceFilename, &media.VideoCodec,
+	}
+	for _, field := range fields {
+		*field = separatorReplacer.Replace(*field)
+	}
+	return media
+}
+
+var separatorReplacer = strings.NewReplacer("/", "-", "\\", "-")
+
+func sanitizeComponent(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20, r == 0x7f:
+			return -1
+		case strings.ContainsRune(`<>"|?*`, r):
+			return -1
+		}
+		return r
+	}, name)
+
+	// "Show: Subtitle" is a common pattern, which reads best as "Show - Subtitle"
+	name = strings.ReplaceAll(name, ": ", " - ")
+	name = strings.ReplaceAll(name, ":", "-")
+
+	// Windows doesn't allow names ending in a dot or space.  This also removes "." and ".." entirely.
+	return strings.TrimRight(strings.TrimSpace(name), ". ")
+}
+
+// ResolutionLabel returns a label like "1080p" for a video size.  The width is used for the common sizes, since
+// cropped widescreen video has a shorter height than its label suggests.
+func ResolutionLabel(width, height int) string {
+	switch {
+	case width <= 0 || height <= 0:
+		return ""
+	case width >= 3800:
+		return "2160p"
+	case width >= 1900:
+		return "1080p"
+	case width >= 1260:
+		return "720p"
+	}
+	return fmt.Sprintf("%dp", height)
+}
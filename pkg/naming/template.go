@@ -0,0 +1,60 @@
+package naming
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// templateNamer builds paths from a user supplied text/template, executed against Media
+type templateNamer struct {
+	tmpl *template.Template
+}
+
+// NewTemplate returns a Namer that builds paths from a text/template, such as:
+//
+//	{{.Name}} ({{.Year}})/Season {{printf "%02d" .Season}}/{{.Name}} - S{{printf "%02d" .Season}}E{{printf "%02d" .Episode}}.mkv
+//
+// The extension of the file being named is added if the result doesn't already end with it.
+func NewTemplate(text string) (Namer, error) {
+	tmpl, err := template.New("name").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing name template: %v", err)
+	}
+
+	// Catch references to fields that don't exist now, instead of after the first transcode
+	namer := &templateNamer{tmpl: tmpl}
+	if _, err := namer.Path(Media{Name: "Name", Type: MediaTypeTV, Season: 1, Episode: 1}); err != nil {
+		return nil, err
+	}
+
+	return namer, nil
+}
+
+func (n *templateNamer) Path(media Media) (string, error) {
+	buf := &strings.Builder{}
+	if err := n.tmpl.Execute(buf, media); err != nil {
+		return "", fmt.Errorf("error while executing name template: %v", err)
+	}
+
+	path := strings.TrimSpace(buf.String())
+	if path == "" {
+		return "", fmt.Errorf("name template produced an empty path")
+	}
+
+	if !strings.HasSuffix(strings.ToLower(path), strings.ToLower(media.extension())) {
+		path += media.extension()
+	}
+
+	return path, nil
+}
+
+func (n *templateNamer) needsStreamInfo() bool {
+	return true
+}
+
+// NeedsStreamInfo checks if namer uses the stream details in Media, which requires probing the file being named
+func NeedsStreamInfo(namer Namer) bool {
+	n, ok := namer.(interface{ needsStreamInfo() bool })
+	return ok && n.needsStreamInfo()
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package pipeline
+
+import (
+	"errors"
+	"os"
+)
+
+// cloneFile is only supported on linux
+func cloneFile(out, in *os.File) error {
+	return errors.New("file cloning is not supported on this platform")
+}
@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Stage identifies a step of the pipeline
+type Stage string
+
+const (
+	StageSplit     Stage = "split"
+	StageAnalyze   Stage = "analyze"
+	StageTranscode Stage = "transcode"
+	StageVerify    Stage = "verify"
+	StageCopy      Stage = "copy"
+)
+
+// StageError records which stage of the pipeline failed, and for which file
+type StageError struct {
+	Input string // Input file given to the pipeline
+	File  string // File being processed when the error occurred (e.g. a split episode)
+	Stage Stage  // Stage that failed
+	Err   error  // Underlying error
+}
+
+func (e *StageError) Error() string {
+	if e.File == "" || e.File == e.Input {
+		return fmt.Sprintf("%s failed for %s: %v", e.Stage, e.Input, e.Err)
+	}
+	return fmt.Sprintf("%s failed for %s (from %s): %v", e.Stage, e.File, e.Input, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// StageErrors returns every StageError contained in err, including errors combined with errors.Join
+func StageErrors(err error) []*StageError {
+	if err == nil {
+		return nil
+	}
+
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		results := make([]*StageError, 0)
+		for _, e := range joined.Unwrap() {
+			results = append(results, StageErrors(e)...)
+		}
+		return results
+	}
+
+	var stageErr *StageError
+	if errors.As(err, &stageErr) {
+		return []*StageError{stageErr}
+	}
+
+	return nil
+}
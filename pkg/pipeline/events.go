@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"github.com/neptune-media/robin/pkg/tasks"
+	"time"
+)
+
+// EventType identifies what an Event reports
+type EventType string
+
+const (
+	EventInputStarted  EventType = "input-started"  // An input is about to be split or queued
+	EventInputFinished EventType = "input-finished" // Every file of an input has finished, or the input failed or was skipped
+	EventStageStarted  EventType = "stage-started"
+	EventStageFinished EventType = "stage-finished"
+	EventProgress      EventType = "progress"      // Transcoding progress for a file
+	EventFileFinished  EventType = "file-finished" // A file has been stored, failed or was skipped
+)
+
+// Event reports progress through the pipeline.  Fields that don't apply to an event's type are left unset.
+type Event struct {
+	Type       EventType
+	Time       time.Time
+	Input      string
+	InputIndex int    // Position of Input in the inputs given to DoAll, from 0
+	Inputs     int    // Number of inputs given to DoAll
+	File       string // File being processed, which is a split output when splitting, or Input itself
+	Episode    int    // Position of File among the files of Input, from 1
+	Episodes   int    // Number of files for Input, once it has been split
+	Stage      Stage
+	Elapsed    time.Duration           // Time the stage took, for stage-finished events
+	Progress   tasks.TranscodeProgress // Set for progress events
+	Output     string                  // Final output path, for file-finished events that succeeded
+	Err        error                   // Why a stage, file or input failed or was skipped
+}
+
+// emit sends event to OnEvent, if it's set
+func (p *Pipeline) emit(event Event) {
+	if p.OnEvent == nil {
+		return
+	}
+	event.Time = time.Now()
+	p.OnEvent(event)
+}
+
+// startStage reports that stage is starting for the file of event, and returns a function that reports it finishing
+func (p *Pipeline) startStage(event Event, stage Stage) func(err error) {
+	started := time.Now()
+	event.Type = EventStageStarted
+	event.Stage = stage
+	p.emit(event)
+
+	return func(err error) {
+		event.Type = EventStageFinished
+		event.Elapsed = time.Since(started)
+		event.Err = err
+		p.emit(event)
+	}
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/tasks"
+	"go.uber.org/zap"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPipeline_OnEvent(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.mkv")
+	writeTestFile(t, input, "input")
+
+	// Every episode is already split and transcoded, so only the copy stage runs
+	j, err := OpenJournal(filepath.Join(dir, JournalFilename), JournalSettings{})
+	if err != nil {
+		t.Fatalf("OpenJournal() error = %v", err)
+	}
+	var episodes []tasks.SplitEpisode
+	for i := 1; i <= 2; i++ {
+		episode := filepath.Join(dir, fmt.Sprintf("episode-%03d.mkv", i))
+		writeTestFile(t, episode, "episode")
+		episodes = append(episodes, tasks.SplitEpisode{Filename: episode, Length: time.Minute})
+	}
+	if err := j.setSplit(input, episodes); err != nil {
+		t.Fatalf("setSplit() error = %v", err)
+	}
+	for _, episode := range episodes {
+		transcoded := strings.TrimSuffix(episode.Filename, ".mkv") + "-output.mkv"
+		writeTestFile(t, transcoded, "transcoded")
+		if err := j.setTranscoded(input, episode.Filename, transcoded); err != nil {
+			t.Fatalf("setTranscoded() error = %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	var got []string
+	p := &Pipeline{
+		Journal:   j,
+		Logger:    zap.NewNop().Sugar(),
+		OutputDir: t.TempDir(),
+		Split:     &tasks.SplitVideo{WorkDir: dir},
+		Transcode: &tasks.TranscodeVideo{WorkDir: dir},
+		OnEvent: func(event Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			summary := []string{string(event.Type), fmt.Sprintf("%d/%d", event.InputIndex+1, event.Inputs)}
+			if event.File != "" {
+				summary = append(summary, filepath.Base(event.File), fmt.Sprintf("%d/%d", event.Episode, event.Episodes))
+			}
+			if event.Stage != "" {
+				summary = append(summary, string(event.Stage))
+			}
+			if event.Output != "" {
+				summary = append(summary, filepath.Base(event.Output))
+			}
+			if event.Err != nil {
+				summary = append(summary, "error")
+			}
+			got = append(got, strings.Join(summary, " "))
+		},
+	}
+
+	if _, err := p.Do(context.Background(), input); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	want := []string{
+		"input-started 1/1",
+		"stage-started 1/1 episode-001.mkv 1/2 copy",
+		"stage-finished 1/1 episode-001.mkv 1/2 copy",
+		"file-finished 1/1 episode-001.mkv 1/2 episode-001-output.mkv",
+		"stage-started 1/1 episode-002.mkv 2/2 copy",
+		"stage-finished 1/1 episode-002.mkv 2/2 copy",
+		"file-finished 1/1 episode-002.mkv 2/2 episode-002-output.mkv",
+		"input-finished 1/1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("OnEvent() got events:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
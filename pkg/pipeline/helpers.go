@@ -1,29 +1,117 @@
 package pipeline
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"go.uber.org/zap"
 	"io"
 	"os"
+	"path/filepath"
+	"time"
 )
 
-func copyFile(sourceName, destName string) error {
+const (
+	copyBufferSize     = 4 << 20 // Large enough to keep disks streaming, for outputs that are often many gigabytes
+	copyReportInterval = 10 * time.Second
+)
+
+// copyToPartial copies sourceName to a temporary ".partial" file next to destName, and returns its name along with the
+// SHA-256 digest of what was copied.  The copy keeps the permissions and modification time of sourceName, and is
+// synced to disk before returning, so renaming it into place can never expose a truncated file.  Nothing is left
+// behind if the copy fails part way through.
+func copyToPartial(logger *zap.SugaredLogger, sourceName, destName string) (partialName, digest string, err error) {
 	// Open source for reading
 	in, err := os.Open(sourceName)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 	defer in.Close()
 
-	// Open destination for writing
-	out, err := os.Create(destName)
+	info, err := in.Stat()
+	if err != nil {
+		return "", "", err
+	}
+
+	// Open destination for writing, using a unique name since several outputs may share a destination
+	out, err := os.CreateTemp(filepath.Dir(destName), filepath.Base(destName)+".*.partial")
+	if err != nil {
+		return "", "", err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(out.Name())
+		}
+	}()
+
+	progress := &copyProgress{
+		logger: logger,
+		name:   sourceName,
+		total:  info.Size(),
+		start:  time.Now(),
+	}
+	progress.last = progress.start
+
+	// Go!  Hashing while copying saves reading the output again for the manifest.
+	hash := sha256.New()
+	buf := make([]byte, copyBufferSize)
+	if _, err := io.CopyBuffer(io.MultiWriter(out, hash, progress), in, buf); err != nil {
+		return "", "", err
+	}
+	logger.Infow("copied output", "file", sourceName, "size", info.Size(), "elapsed", time.Since(progress.start).Round(time.Millisecond))
+
+	if err := preserveAttributes(in, out); err != nil {
+		return "", "", err
+	}
+	return out.Name(), hex.EncodeToString(hash.Sum(nil)), out.Sync()
+}
+
+// copyProgress logs how far along a copy is, at most once every copyReportInterval
+type copyProgress struct {
+	logger *zap.SugaredLogger
+	name   string
+	total  int64
+
+	copied int64
+	start  time.Time
+	last   time.Time
+}
+
+func (c *copyProgress) Write(p []byte) (int, error) {
+	c.copied += int64(len(p))
+	if now := time.Now(); now.Sub(c.last) >= copyReportInterval {
+		c.last = now
+		percent := 100.0
+		if c.total > 0 {
+			percent = float64(c.copied) * 100 / float64(c.total)
+		}
+		c.logger.Infow("copying output", "file", c.name, "copied", c.copied, "total", c.total,
+			"percent", int(percent))
+	}
+	return len(p), nil
+}
+
+// syncFile flushes the contents of the file at path to disk
+func syncFile(path string) error {
+	f, err := os.Open(path)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	defer f.Close()
+
+	return f.Sync()
+}
 
-	// Allocate a 4k buffer
-	buf := make([]byte, 4096)
+// syncDir flushes a directory entry change, such as a rename, to disk.  This isn't supported everywhere, so it's best
+// effort only.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
 
-	// Go!
-	_, err = io.CopyBuffer(out, in, buf)
-	return err
+	_ = d.Sync()
 }
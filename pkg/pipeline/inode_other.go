@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package pipeline
+
+import "os"
+
+// fileInode is only supported on linux, macOS and FreeBSD, and always returns 0 elsewhere
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,16 @@
+//go:build linux || darwin || freebsd
+
+package pipeline
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode returns the inode number of a file, or 0 if it isn't known
+func fileInode(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,308 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/neptune-media/robin/pkg/tasks"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// JournalFilename is the name of the journal file inside a work dir
+const JournalFilename = "journal.json"
+
+// Journal records the stages completed for each input and episode, so an interrupted run can be resumed.
+// A nil *Journal is valid, and records nothing.
+type Journal struct {
+	Inputs   map[string]*journalInput `json:"inputs"`
+	Settings JournalSettings          `json:"settings"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// JournalSettings describes the settings that recorded files depend on, such as digests of the flags they were named
+// and transcoded with.  Files recorded with other settings aren't reused.
+type JournalSettings struct {
+	Naming    string `json:"naming"`    // Settings that output names depend on
+	Templates string `json:"templates"` // Transcoding options, which transcoded files and outputs depend on
+}
+
+type journalInput struct {
+	Source   journalFile                `json:"source"`             // Input file, used to detect if it changed
+	Split    []journalFile              `json:"split,omitempty"`    // Files produced by the split stage
+	Episodes map[string]*journalEpisode `json:"episodes,omitempty"` // Progress for each file, keyed by path
+}
+
+type journalEpisode struct {
+	Analyze    *tasks.AnalyzeResults `json:"analyze,omitempty"`
+	Transcoded *journalFile          `json:"transcoded,omitempty"`
+	Output     *journalFile          `json:"output,omitempty"`
+}
+
+// journalFile is a file produced by a stage, along with enough of its details to tell if it changed before it's reused
+type journalFile struct {
+	Path    string        `json:"path"`
+	Size    int64         `json:"size"`
+	ModTime time.Time     `json:"mod_time"`
+	Inode   uint64        `json:"inode,omitempty"`  // Where the platform has them, so a file replaced by another is caught
+	Length  time.Duration `json:"length,omitempty"` // Length of split episodes
+}
+
+// OpenJournal loads the journal at path, or starts an empty one if it doesn't exist yet.  Files recorded with other
+// settings are forgotten, so they're produced again.
+func OpenJournal(path string, settings JournalSettings) (*Journal, error) {
+	j := &Journal{
+		Inputs:   make(map[string]*journalInput),
+		Settings: settings,
+		path:     path,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, err
+	}
+	if j.Inputs == nil {
+		j.Inputs = make(map[string]*journalInput)
+	}
+
+	// Splitting and analyzing don't depend on the settings, so those results are kept
+	templatesChanged := j.Settings.Templates != settings.Templates
+	if templatesChanged || j.Settings.Naming != settings.Naming {
+		for _, record := range j.Inputs {
+			for _, episode := range record.Episodes {
+				if templatesChanged {
+					episode.Transcoded = nil
+				}
+				episode.Output = nil
+			}
+		}
+	}
+	j.Settings = settings
+
+	return j, nil
+}
+
+// getSplit returns the files previously split from input, if all of them are still valid
+func (j *Journal) getSplit(input string) ([]tasks.SplitEpisode, bool) {
+	if j == nil {
+		return nil, false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	record := j.getInput(input)
+	if len(record.Split) == 0 {
+		return nil, false
+	}
+
+	episodes := make([]tasks.SplitEpisode, len(record.Split))
+	for i, f := range record.Split {
+		if !f.valid() {
+			return nil, false
+		}
+		episodes[i] = tasks.SplitEpisode{Filename: f.Path, Length: f.Length}
+	}
+
+	return episodes, true
+}
+
+func (j *Journal) setSplit(input string, episodes []tasks.SplitEpisode) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	split := make([]journalFile, len(episodes))
+	for i, episode := range episodes {
+		f, err := newJournalFile(episode.Filename)
+		if err != nil {
+			return err
+		}
+		f.Length = episode.Length
+		split[i] = f
+	}
+
+	// Previous progress on episodes no longer applies to a new split
+	record := j.getInput(input)
+	record.Split = split
+	record.Episodes = make(map[string]*journalEpisode)
+	return j.save()
+}
+
+func (j *Journal) getAnalyze(input, file string) (*tasks.AnalyzeResults, bool) {
+	if j == nil {
+		return nil, false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	episode := j.getEpisode(input, file)
+	return episode.Analyze, episode.Analyze != nil
+}
+
+func (j *Journal) setAnalyze(input, file string, results *tasks.AnalyzeResults) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.getEpisode(input, file).Analyze = results
+	return j.save()
+}
+
+func (j *Journal) getTranscoded(input, file string) (string, bool) {
+	if j == nil {
+		return "", false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	transcoded := j.getEpisode(input, file).Transcoded
+	if transcoded == nil || !transcoded.valid() {
+		return "", false
+	}
+	return transcoded.Path, true
+}
+
+func (j *Journal) setTranscoded(input, file, transcoded string) error {
+	return j.setFile(input, file, transcoded, func(episode *journalEpisode, f *journalFile) {
+		episode.Transcoded = f
+	})
+}
+
+// clearTranscoded forgets the transcoded file for file, so that resuming transcodes it again
+func (j *Journal) clearTranscoded(input, file string) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.getEpisode(input, file).Transcoded = nil
+	return j.save()
+}
+
+func (j *Journal) getOutput(input, file string) (string, bool) {
+	if j == nil {
+		return "", false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	output := j.getEpisode(input, file).Output
+	if output == nil || !output.valid() {
+		return "", false
+	}
+	return output.Path, true
+}
+
+func (j *Journal) setOutput(input, file, output string) error {
+	return j.setFile(input, file, output, func(episode *journalEpisode, f *journalFile) {
+		episode.Output = f
+	})
+}
+
+func (j *Journal) setFile(input, file, path string, set func(*journalEpisode, *journalFile)) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := newJournalFile(path)
+	if err != nil {
+		return err
+	}
+
+	set(j.getEpisode(input, file), &f)
+	return j.save()
+}
+
+// getInput returns the record for input, starting a new one if input is new or has changed since it was recorded.
+// Must be called with the lock held.
+func (j *Journal) getInput(input string) *journalInput {
+	source, _ := newJournalFile(input)
+
+	record, ok := j.Inputs[source.Path]
+	if !ok || !record.Source.same(source) {
+		record = &journalInput{Source: source}
+		j.Inputs[source.Path] = record
+	}
+	if record.Episodes == nil {
+		record.Episodes = make(map[string]*journalEpisode)
+	}
+
+	return record
+}
+
+// getEpisode returns the record for file, starting a new one if needed.  Must be called with the lock held.
+func (j *Journal) getEpisode(input, file string) *journalEpisode {
+	record := j.getInput(input)
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+
+	episode, ok := record.Episodes[file]
+	if !ok {
+		episode = &journalEpisode{}
+		record.Episodes[file] = episode
+	}
+
+	return episode
+}
+
+// save writes the journal to a temporary file first, so an interruption never leaves a truncated journal behind.
+// Must be called with the lock held.
+func (j *Journal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, j.path)
+}
+
+func newJournalFile(path string) (journalFile, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return journalFile{}, err
+	}
+
+	info, err := os.Stat(abs)
+	if err != nil {
+		return journalFile{Path: abs}, err
+	}
+
+	return journalFile{Path: abs, Size: info.Size(), ModTime: info.ModTime(), Inode: fileInode(info)}, nil
+}
+
+// valid checks that the file still exists and hasn't changed since it was recorded
+func (f journalFile) valid() bool {
+	info, err := os.Stat(f.Path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	return f.same(journalFile{Path: f.Path, Size: info.Size(), ModTime: info.ModTime(), Inode: fileInode(info)})
+}
+
+// same reports whether f and other describe the same version of a file
+func (f journalFile) same(other journalFile) bool {
+	return f.Path == other.Path && f.Size == other.Size && f.ModTime.Equal(other.ModTime) && f.Inode == other.Inode
+}
@@ -0,0 +1,144 @@
+package pipeline
+
+import (
+	"github.com/neptune-media/robin/pkg/tasks"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJournal_Resume(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.mkv")
+	episode := filepath.Join(dir, "episode-001.mkv")
+	transcoded := filepath.Join(dir, "episode-001-output.mkv")
+	writeTestFile(t, input, "input")
+	writeTestFile(t, episode, "episode")
+	writeTestFile(t, transcoded, "transcoded")
+
+	journalPath := filepath.Join(dir, JournalFilename)
+	j, err := OpenJournal(journalPath, JournalSettings{})
+	if err != nil {
+		t.Fatalf("OpenJournal() error = %v", err)
+	}
+	if err := j.setSplit(input, []tasks.SplitEpisode{{Filename: episode, Length: time.Minute}}); err != nil {
+		t.Fatalf("setSplit() error = %v", err)
+	}
+	if err := j.setAnalyze(input, episode, &tasks.AnalyzeResults{TotalFrames: 24}); err != nil {
+		t.Fatalf("setAnalyze() error = %v", err)
+	}
+	if err := j.setTranscoded(input, episode, transcoded); err != nil {
+		t.Fatalf("setTranscoded() error = %v", err)
+	}
+
+	// Reload from disk, like a resumed run would
+	j, err = OpenJournal(journalPath, JournalSettings{})
+	if err != nil {
+		t.Fatalf("OpenJournal() error = %v", err)
+	}
+
+	if episodes, ok := j.getSplit(input); !ok || len(episodes) != 1 || episodes[0].Filename != episode || episodes[0].Length != time.Minute {
+		t.Errorf("getSplit() got = %v, %v, want [{%s 1m0s}], true", episodes, ok, episode)
+	}
+	if results, ok := j.getAnalyze(input, episode); !ok || results.TotalFrames != 24 {
+		t.Errorf("getAnalyze() got = %v, %v, want 24 frames", results, ok)
+	}
+	if got, ok := j.getTranscoded(input, episode); !ok || got != transcoded {
+		t.Errorf("getTranscoded() got = %v, %v, want %s, true", got, ok, transcoded)
+	}
+	if _, ok := j.getOutput(input, episode); ok {
+		t.Errorf("getOutput() got ok for an episode that was never copied")
+	}
+
+	// A truncated intermediate file must not be reused
+	writeTestFile(t, transcoded, "trunc")
+	if _, ok := j.getTranscoded(input, episode); ok {
+		t.Errorf("getTranscoded() got ok for a file that changed size")
+	}
+
+	// So must a file that was rewritten with the same size
+	if err := j.setTranscoded(input, episode, transcoded); err != nil {
+		t.Fatalf("setTranscoded() error = %v", err)
+	}
+	writeTestFile(t, transcoded, "trans")
+	if err := os.Chtimes(transcoded, time.Time{}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := j.getTranscoded(input, episode); ok {
+		t.Errorf("getTranscoded() got ok for a file that was modified")
+	}
+
+	// Changing the input discards everything recorded for it
+	writeTestFile(t, input, "a different input")
+	if _, ok := j.getSplit(input); ok {
+		t.Errorf("getSplit() got ok for an input that changed")
+	}
+}
+
+func TestJournal_Settings(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.mkv")
+	episode := filepath.Join(dir, "episode-001.mkv")
+	transcoded := filepath.Join(dir, "episode-001-output.mkv")
+	output := filepath.Join(dir, "Show - s01e01.mkv")
+	writeTestFile(t, input, "input")
+	writeTestFile(t, episode, "episode")
+	writeTestFile(t, transcoded, "transcoded")
+	writeTestFile(t, output, "output")
+
+	settings := JournalSettings{Naming: "plex", Templates: "x265"}
+	tests := []struct {
+		name           string
+		settings       JournalSettings
+		wantTranscoded bool
+		wantOutput     bool
+	}{
+		{name: "unchanged", settings: settings, wantTranscoded: true, wantOutput: true},
+		{name: "naming", settings: JournalSettings{Naming: "jellyfin", Templates: "x265"}, wantTranscoded: true},
+		{name: "templates", settings: JournalSettings{Naming: "plex", Templates: "x264"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			journalPath := filepath.Join(t.TempDir(), JournalFilename)
+			j, err := OpenJournal(journalPath, settings)
+			if err != nil {
+				t.Fatalf("OpenJournal() error = %v", err)
+			}
+			if err := j.setTranscoded(input, episode, transcoded); err != nil {
+				t.Fatalf("setTranscoded() error = %v", err)
+			}
+			if err := j.setOutput(input, episode, output); err != nil {
+				t.Fatalf("setOutput() error = %v", err)
+			}
+
+			j, err = OpenJournal(journalPath, tt.settings)
+			if err != nil {
+				t.Fatalf("OpenJournal() error = %v", err)
+			}
+			if _, ok := j.getTranscoded(input, episode); ok != tt.wantTranscoded {
+				t.Errorf("getTranscoded() got ok = %v, want %v", ok, tt.wantTranscoded)
+			}
+			if _, ok := j.getOutput(input, episode); ok != tt.wantOutput {
+				t.Errorf("getOutput() got ok = %v, want %v", ok, tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestJournal_Nil(t *testing.T) {
+	var j *Journal
+	if err := j.setSplit("input.mkv", []tasks.SplitEpisode{{Filename: "episode.mkv"}}); err != nil {
+		t.Errorf("setSplit() error = %v", err)
+	}
+	if _, ok := j.getSplit("input.mkv"); ok {
+		t.Errorf("getSplit() got ok from a nil journal")
+	}
+}
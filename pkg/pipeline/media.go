@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/naming"
+)
+
+// ErrNumberingUnknown is reported for inputs whose episode numbers carry on from an earlier input that failed before
+// its files were counted
+var ErrNumberingUnknown = errors.New("episode numbers are unknown")
+
+// episodeNumberer hands out the media details for every file, numbering episodes in split order across inputs
+type episodeNumberer struct {
+	defaults   naming.Media
+	inputMedia map[string]naming.Media
+
+	current naming.Media
+	failed  string // Earlier input that failed before its files were counted, so numbers carrying on from it are unknown
+	next    int
+	started bool
+}
+
+func (p *Pipeline) newEpisodeNumberer() *episodeNumberer {
+	return &episodeNumberer{defaults: p.Media, inputMedia: p.InputMedia}
+}
+
+// startInput switches to the media details for input.  Numbering restarts if input has its own episode number, or if
+// it belongs to a different show or season than the previous input, and otherwise carries on from the previous input.
+func (n *episodeNumberer) startInput(input string) {
+	media := n.mediaFor(input)
+	if n.restarts(media) {
+		n.failed = ""
+	}
+
+	switch {
+	case media.Episode > 0:
+		n.next = media.Episode
+	case !n.started:
+		n.next = n.defaults.Episode
+	case media.Name != n.current.Name || media.Season != n.current.Season:
+		n.next = 1
+	}
+
+	n.current = media
+	n.started = true
+}
+
+// checkInput reports an error if the episode numbers of input would carry on from an input that failed before its
+// files were counted, since they can't be known
+func (n *episodeNumberer) checkInput(input string) error {
+	if n.failed == "" || n.restarts(n.mediaFor(input)) {
+		return nil
+	}
+	return fmt.Errorf("%w: they carry on from %s, which failed before its files were counted (give the input its own episode number to process it anyway)",
+		ErrNumberingUnknown, n.failed)
+}
+
+// skipInput numbers an input that failed before its files were queued.  When count, the number of episodes it would
+// have had, is known they're still used up, so later inputs keep their numbers.  Otherwise it's -1, and later inputs
+// that carry on numbering from it fail checkInput.
+func (n *episodeNumberer) skipInput(input string, count int) {
+	n.startInput(input)
+	if count < 0 {
+		n.failed = input
+		return
+	}
+	n.next += count
+}
+
+// mediaFor returns the media details for input, without an episode number unless input has its own
+func (n *episodeNumberer) mediaFor(input string) naming.Media {
+	media, ok := n.inputMedia[input]
+	if !ok {
+		media = n.defaults
+		media.Episode = 0
+	}
+	return media
+}
+
+// restarts reports whether numbering starts over for an input with media, rather than carrying on
+func (n *episodeNumberer) restarts(media naming.Media) bool {
+	return media.Episode > 0 || !n.started || media.Name != n.current.Name || media.Season != n.current.Season
+}
+
+// nextEpisode returns the episode number that the next input of the default show and season would start at, or 0
+// if the last input numbered belonged to something else
+func (n *episodeNumberer) nextEpisode() int {
+	if !n.started || n.failed != "" || n.current.Name != n.defaults.Name || n.current.Season != n.defaults.Season {
+		return 0
+	}
+	return n.next
+}
+
+// nextMedia returns the media details for the next file of the current input, which holds count episodes
+func (n *episodeNumberer) nextMedia(count int) naming.Media {
+	media := n.current
+	media.Episode = n.next
+	if count > 1 {
+		media.EpisodeCount = count
+	}
+	n.next += count
+	return media
+}
+
+// extraMedia returns the media details for an extra of the current input, which doesn't use up an episode number
+func (n *episodeNumberer) extraMedia(extra string) naming.Media {
+	media := n.current
+	media.Episode = 0
+	media.Extra = extra
+	return media
+}
+
+// assignMedia returns the media details for each file of the current input.  Files shorter than ExtraMaxLength
+// become extras, split tv episodes longer than DoubleEpisodeLength are counted as two episodes, and a movie that ends
+// up in several files is numbered in parts.
+func (p *Pipeline) assignMedia(n *episodeNumberer, files []inputFile) []naming.Media {
+	extraType := p.ExtraType
+	if extraType == "" {
+		extraType = naming.ExtraFeaturette
+	}
+
+	media := make([]naming.Media, len(files))
+	parts := make([]int, 0, len(files))
+	for i, file := range files {
+		switch {
+		case p.ExtraMaxLength > 0 && file.length > 0 && file.length < p.ExtraMaxLength:
+			media[i] = n.extraMedia(extraType)
+		case p.Split != nil && p.DoubleEpisodeLength > 0 && file.length >= p.DoubleEpisodeLength && n.current.Type == naming.MediaTypeTV:
+			media[i] = n.nextMedia(2)
+		default:
+			media[i] = n.nextMedia(1)
+		}
+
+		if media[i].Extra == "" {
+			parts = append(parts, i)
+		}
+		if media[i].Extra != "" || media[i].EpisodeCount > 1 {
+			p.Logger.Infow("detected file type from its length",
+				"file", file.name,
+				"length", file.length,
+				"extra", media[i].Extra,
+				"episodes", media[i].EpisodeCount)
+		}
+	}
+
+	if len(parts) > 1 && n.current.Type == naming.MediaTypeMovie {
+		for part, i := range parts {
+			media[i].Part = part + 1
+		}
+	}
+
+	return media
+}
@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"errors"
+	"github.com/neptune-media/robin/pkg/naming"
+	"github.com/neptune-media/robin/pkg/tasks"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestEpisodeNumberer(t *testing.T) {
+	p := &Pipeline{
+		Media: naming.Media{Name: "Show", Season: 1, Episode: 3},
+		InputMedia: map[string]naming.Media{
+			"s1d2.mkv":  {Name: "Show", Season: 1},
+			"s2d1.mkv":  {Name: "Show", Season: 2},
+			"s2e07.mkv": {Name: "Show", Season: 2, Episode: 7},
+		},
+	}
+
+	// Each input is split into two files
+	inputs := []string{"s1d1.mkv", "s1d2.mkv", "s2d1.mkv", "s2e07.mkv"}
+	want := []int{3, 4, 5, 6, 1, 2, 7, 8}
+
+	numberer := p.newEpisodeNumberer()
+	got := make([]int, 0, len(want))
+	for _, input := range inputs {
+		numberer.startInput(input)
+		for i := 0; i < 2; i++ {
+			got = append(got, numberer.nextMedia(1).Episode)
+		}
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("episode numbers got = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestEpisodeNumberer_skipInput(t *testing.T) {
+	p := &Pipeline{
+		Media: naming.Media{Name: "Show", Season: 1, Episode: 1},
+		InputMedia: map[string]naming.Media{
+			"s2e07.mkv": {Name: "Show", Season: 2, Episode: 7},
+		},
+	}
+
+	numberer := p.newEpisodeNumberer()
+	numberer.startInput("d1.mkv")
+	numberer.nextMedia(1)
+
+	// A failed input with a known number of files still uses up its episode numbers
+	numberer.skipInput("d2.mkv", 1)
+	numberer.startInput("d3.mkv")
+	if got := numberer.nextMedia(1).Episode; got != 3 {
+		t.Errorf("episode after a skipped input got = %d, want 3", got)
+	}
+	if got := numberer.nextEpisode(); got != 4 {
+		t.Errorf("nextEpisode() got = %d, want 4", got)
+	}
+
+	// Without a count, inputs carrying on from it can't be numbered until numbering restarts
+	numberer.skipInput("d4.mkv", -1)
+	if err := numberer.checkInput("d5.mkv"); !errors.Is(err, ErrNumberingUnknown) {
+		t.Errorf("checkInput() error = %v, want %v", err, ErrNumberingUnknown)
+	}
+	if got := numberer.nextEpisode(); got != 0 {
+		t.Errorf("nextEpisode() got = %d, want 0 while numbers are unknown", got)
+	}
+	if err := numberer.checkInput("s2e07.mkv"); err != nil {
+		t.Errorf("checkInput() error = %v for an input with its own episode number", err)
+	}
+	numberer.startInput("s2e07.mkv")
+	if err := numberer.checkInput("d5.mkv"); err != nil {
+		t.Errorf("checkInput() error = %v after numbering restarted", err)
+	}
+}
+
+func TestPipeline_assignMedia(t *testing.T) {
+	files := []inputFile{
+		{name: "a.mkv", length: 22 * time.Minute},
+		{name: "b.mkv", length: 44 * time.Minute},
+		{name: "c.mkv", length: 5 * time.Minute},
+		{name: "d.mkv", length: 22 * time.Minute},
+	}
+
+	tests := []struct {
+		name      string
+		media     naming.Media
+		want      []int // Episode or part number of each file, 0 for extras
+		wantCount []int // EpisodeCount of each file
+	}{
+		{
+			name:      "tv",
+			media:     naming.Media{Name: "Show", Type: "tv", Season: 1, Episode: 1},
+			want:      []int{1, 2, 0, 4},
+			wantCount: []int{0, 2, 0, 0},
+		},
+		{
+			name:      "movie",
+			media:     naming.Media{Name: "Movie", Type: "movie"},
+			want:      []int{1, 2, 0, 3},
+			wantCount: []int{0, 0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pipeline{
+				DoubleEpisodeLength: 40 * time.Minute,
+				ExtraMaxLength:      10 * time.Minute,
+				Logger:              zap.NewNop().Sugar(),
+				Media:               tt.media,
+				Split:               &tasks.SplitVideo{},
+			}
+
+			numberer := p.newEpisodeNumberer()
+			numberer.startInput("input.mkv")
+			got := p.assignMedia(numberer, files)
+
+			for i, media := range got {
+				number := media.Episode
+				if media.Type == "movie" {
+					number = media.Part
+				}
+				if media.Extra != "" {
+					number = 0
+				}
+				if (media.Extra != "") != (tt.want[i] == 0) || number != tt.want[i] || media.EpisodeCount != tt.wantCount[i] {
+					t.Errorf("assignMedia() file %d got = %+v, want number %d and count %d", i+1, media, tt.want[i], tt.wantCount[i])
+				}
+			}
+			if got[2].Extra != naming.ExtraFeaturette {
+				t.Errorf("assignMedia() got extra type %q, want %q", got[2].Extra, naming.ExtraFeaturette)
+			}
+		})
+	}
+}
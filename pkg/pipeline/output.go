@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CollisionPolicy decides what happens when an output file already exists
+type CollisionPolicy string
+
+const (
+	CollisionFail         CollisionPolicy = "fail"          // Fails the episode, leaving the existing file alone
+	CollisionKeepLarger   CollisionPolicy = "keep-larger"   // Keeps whichever of the two files is larger
+	CollisionOverwrite    CollisionPolicy = "overwrite"     // Replaces the existing file
+	CollisionRenameSuffix CollisionPolicy = "rename-suffix" // Stores the new file next to the existing one, with a numbered suffix
+	CollisionSkip         CollisionPolicy = "skip"          // Keeps the existing file, and treats the episode as done
+)
+
+// ErrOutputExists is reported for episodes whose output already exists, with the fail collision policy
+var ErrOutputExists = errors.New("output already exists")
+
+var collisionPolicies = []CollisionPolicy{
+	CollisionFail,
+	CollisionKeepLarger,
+	CollisionOverwrite,
+	CollisionRenameSuffix,
+	CollisionSkip,
+}
+
+// ParseCollisionPolicy returns the CollisionPolicy named by s
+func ParseCollisionPolicy(s string) (CollisionPolicy, error) {
+	for _, policy := range collisionPolicies {
+		if string(policy) == s {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown collision policy: %s (expected one of %s)", s, strings.Join(CollisionPolicies(), ", "))
+}
+
+// CollisionPolicies returns the names of every collision policy
+func CollisionPolicies() []string {
+	names := make([]string, len(collisionPolicies))
+	for i, policy := range collisionPolicies {
+		names[i] = string(policy)
+	}
+	return names
+}
+
+func (p *Pipeline) getCollisionPolicy() CollisionPolicy {
+	if p.Collision == "" {
+		return CollisionFail
+	}
+	return p.Collision
+}
+
+// PlaceFile moves source to dest like an output of the pipeline, following the collision policy and transfer mode, and
+// returns where the file ended up.  This lets commands that don't run a pipeline store files the same way.
+func (p *Pipeline) PlaceFile(source, dest string) (string, error) {
+	output, _, err := p.placeOutput(source, dest)
+	return output, err
+}
+
+// placeOutput moves source to dest with the transfer mode, following the collision policy, and returns where the
+// output ended up, along with its SHA-256 digest if it was computed while copying.  The file only appears at its
+// final name once it has been completely written, so a library scan never sees a partial file.
+func (p *Pipeline) placeOutput(source, dest string) (output, digest string, err error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Avoid transferring at all if the existing file wins
+	if output, done, err := p.checkCollision(dest, info.Size()); done {
+		return output, "", err
+	}
+
+	partial, err := p.transferToPartial(source, dest)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Another worker may have placed a file at dest during the transfer, so decide again while holding the lock
+	p.placeMu.Lock()
+	defer p.placeMu.Unlock()
+
+	output, done, err := p.checkCollision(dest, info.Size())
+	if done {
+		p.discardPartial(partial, source)
+		return output, "", err
+	}
+	if p.getCollisionPolicy() == CollisionRenameSuffix {
+		dest = AvailablePath(dest)
+	}
+
+	if err := os.Rename(partial.name, dest); err != nil {
+		p.discardPartial(partial, source)
+		return "", "", err
+	}
+	syncDir(filepath.Dir(dest))
+
+	return dest, partial.sha256, nil
+}
+
+// checkCollision applies the collision policy to dest, for a new file of the given size.  When done is set, the
+// policy settled things without placing the new file, and output or err hold the outcome for the episode.
+func (p *Pipeline) checkCollision(dest string, size int64) (output string, done bool, err error) {
+	existing, err := os.Stat(dest)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	} else if err != nil {
+		return "", true, err
+	}
+
+	switch p.getCollisionPolicy() {
+	case CollisionSkip:
+		p.Logger.Infow("keeping existing output", "output", dest)
+		return dest, true, nil
+	case CollisionKeepLarger:
+		if existing.Size() >= size {
+			p.Logger.Infow("keeping existing output, which is at least as large", "output", dest,
+				"existing-size", existing.Size(), "size", size)
+			return dest, true, nil
+		}
+		p.Logger.Infow("replacing smaller existing output", "output", dest,
+			"existing-size", existing.Size(), "size", size)
+		return "", false, nil
+	case CollisionOverwrite:
+		p.Logger.Infow("overwriting existing output", "output", dest)
+		return "", false, nil
+	case CollisionRenameSuffix:
+		return "", false, nil
+	}
+
+	return "", true, fmt.Errorf("%w: %s", ErrOutputExists, dest)
+}
+
+// AvailablePath returns path, or path with the first numbered suffix that isn't taken yet, like "name (2).mkv"
+func AvailablePath(path string) string {
+	if _, err := os.Lstat(path); errors.Is(err, os.ErrNotExist) {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if _, err := os.Lstat(candidate); errors.Is(err, os.ErrNotExist) {
+			return candidate
+		}
+	}
+}
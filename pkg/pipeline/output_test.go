@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"errors"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPipeline_placeOutput(t *testing.T) {
+	tests := []struct {
+		policy      CollisionPolicy
+		existing    string // Contents of the existing output, or empty if there isn't one
+		wantName    string
+		wantContent string
+		wantErr     error
+	}{
+		{policy: CollisionFail, wantName: "out.mkv", wantContent: "new file"},
+		{policy: CollisionFail, existing: "old", wantName: "out.mkv", wantContent: "old", wantErr: ErrOutputExists},
+		{policy: CollisionSkip, existing: "old", wantName: "out.mkv", wantContent: "old"},
+		{policy: CollisionOverwrite, existing: "old", wantName: "out.mkv", wantContent: "new file"},
+		{policy: CollisionRenameSuffix, existing: "old", wantName: "out (2).mkv", wantContent: "new file"},
+		{policy: CollisionKeepLarger, existing: "old", wantName: "out.mkv", wantContent: "new file"},
+		{policy: CollisionKeepLarger, existing: "a much larger file", wantName: "out.mkv", wantContent: "a much larger file"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy)+"/"+tt.existing, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "source.mkv")
+			dest := filepath.Join(dir, "out.mkv")
+			writeTestFile(t, source, "new file")
+			if tt.existing != "" {
+				writeTestFile(t, dest, tt.existing)
+			}
+
+			p := &Pipeline{Collision: tt.policy, Logger: zap.NewNop().Sugar()}
+			got, _, err := p.placeOutput(source, dest)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("placeOutput() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != filepath.Join(dir, tt.wantName) {
+				t.Errorf("placeOutput() got = %v, want %v", got, filepath.Join(dir, tt.wantName))
+			}
+
+			content, err := os.ReadFile(filepath.Join(dir, tt.wantName))
+			if err != nil || string(content) != tt.wantContent {
+				t.Errorf("output contents got = %q, %v, want %q", content, err, tt.wantContent)
+			}
+
+			// Nothing should be left behind besides the source and outputs
+			partials, _ := filepath.Glob(filepath.Join(dir, "*.partial"))
+			if len(partials) > 0 {
+				t.Errorf("placeOutput() left partial files behind: %v", partials)
+			}
+		})
+	}
+}
+
+func TestPipeline_placeOutput_moveFailure(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.mkv")
+	writeTestFile(t, source, "hours of transcoding")
+
+	// A non-empty directory at dest lets the transfer succeed, but not the final rename
+	dest := filepath.Join(dir, "out.mkv")
+	if err := os.MkdirAll(filepath.Join(dest, "taken"), 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Pipeline{Collision: CollisionOverwrite, Logger: zap.NewNop().Sugar(), Transfer: TransferMove}
+	if _, _, err := p.placeOutput(source, dest); err == nil {
+		t.Fatalf("placeOutput() error = nil, want the rename to fail")
+	}
+
+	content, err := os.ReadFile(source)
+	if err != nil || string(content) != "hours of transcoding" {
+		t.Errorf("source contents got = %q, %v, want the moved file returned", content, err)
+	}
+	partials, _ := filepath.Glob(filepath.Join(dir, "*.partial"))
+	if len(partials) > 0 {
+		t.Errorf("placeOutput() left partial files behind: %v", partials)
+	}
+}
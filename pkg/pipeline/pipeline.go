@@ -2,111 +2,563 @@ package pipeline
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/neptune-media/robin/pkg/naming"
 	"github.com/neptune-media/robin/pkg/tasks"
 	"go.uber.org/zap"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Pipeline struct {
-	Analyze   *tasks.AnalyzeVideo
-	Logger    *zap.SugaredLogger
-	Plex      PlexOptions
-	OutputDir string
-	Split     *tasks.SplitVideo
-	Transcode *tasks.TranscodeVideo
+	Analyze             *tasks.AnalyzeVideo
+	Collision           CollisionPolicy // Decides what happens when an output already exists.  Defaults to fail
+	ContinueOnError     bool            // Keeps processing remaining inputs and split episodes when one of them fails
+	DoubleEpisodeLength time.Duration   // Split tv episodes at least this long are named as two episodes.  0 disables
+	ExtraMaxLength      time.Duration   // Files shorter than this are named as extras rather than episodes or parts.  0 disables
+	ExtraType           string          // Extra type used for short files.  Defaults to featurette
+	Journal             *Journal        // Records completed stages, and allows skipping them when resuming
+	Logger              *zap.SugaredLogger
+	Library             naming.Namer            // Names outputs for a media library, or keeps their names when nil
+	Media               naming.Media            // Describes the inputs for Library, where Episode is the number of the first episode.  Do and DoAll advance it past the episodes they number
+	InputMedia          map[string]naming.Media // Replaces Media for specific inputs, such as details parsed from filenames
+	OnEvent             func(event Event)       // Called as the pipeline makes progress, possibly from several workers at once
+	OutputDir           string
+	SpaceCheck          SpaceCheck // Decides what happens when the work dir or output dir runs low on space.  Off when empty
+	Split               *tasks.SplitVideo
+	Transcode           *tasks.TranscodeVideo
+	Transfer            TransferMode       // How transcoded files are moved into the output dir.  Defaults to copy
+	Verify              *tasks.VerifyVideo // Checks transcoded files before they are stored, when set
+	Workers             int                // Number of episodes to analyze, transcode and copy concurrently.  The limit is shared by every input, not applied per input
+
+	placeMu       sync.Mutex // Serializes collision checks with placing outputs, since workers may share a destination
+	spaceMu       sync.Mutex
+	spaceReserved map[uint64]uint64 // Space estimated for files being transcoded, by filesystem device
+	stopping      atomic.Bool
+}
+
+// Result holds the outcome of running the pipeline for a single input
+type Result struct {
+	Input    string
+	Outputs  []string
+	Episodes []EpisodeResult // Every file processed for the input, in split order
+	Err      error
+}
+
+// EpisodeResult holds the outcome for a single file of an input
+type EpisodeResult struct {
+	File   string // File given to the transcoder, which is a split output when splitting
+	Output string // Final output path, or empty if the file failed or was skipped
+	SHA256 string // Digest of Output, if it was computed while copying it there
+}
+
+var (
+	// ErrSkipped is reported for inputs that were never processed because of an earlier failure
+	ErrSkipped = errors.New("skipped after an earlier failure")
+
+	// ErrStopped is reported for inputs that were not fully processed because Stop was called
+	ErrStopped = errors.New("stopped before finishing")
+)
+
+// inputFile is a file to process for an input, along with what is already known about it
+type inputFile struct {
+	name   string
+	length time.Duration // Length of the video, or 0 if it isn't known yet
+}
+
+// episodeJob describes a single file to be analyzed, transcoded and copied by a worker
+type episodeJob struct {
+	file       inputFile
+	index      int // Position of the file in the split output
+	episodes   int // Number of files in the split output
+	inputIndex int
+	inputs     int
+	media      naming.Media
+	transcode  *tasks.TranscodeVideo
 }
 
-type PlexOptions struct {
-	Enabled   bool
-	Episode   int
-	MediaType string
-	Name      string
-	Season    int
-	Year      int
+// event returns the details shared by every event for the job
+func (j episodeJob) event(input string) Event {
+	return Event{
+		Input:      input,
+		InputIndex: j.inputIndex,
+		Inputs:     j.inputs,
+		File:       j.file.name,
+		Episode:    j.index + 1,
+		Episodes:   j.episodes,
+	}
 }
 
 func (p *Pipeline) Do(ctx context.Context, input string) ([]string, error) {
-	var err error
-	files := []string{input}
+	result := p.DoAll(ctx, []string{input})[0]
+	return result.Outputs, result.Err
+}
 
-	// Split the input file into multiple files
-	if p.Split != nil {
-		files, err = p.Split.Do(context.TODO(), input)
+// DoAll runs the pipeline for every input.  Inputs are split one at a time and in order, so that episode
+// numbers follow split order, while the resulting episodes are handed to a pool of workers shared by all inputs.
+func (p *Pipeline) DoAll(ctx context.Context, inputs []string) []Result {
+	results := make([]Result, len(inputs))
+	files := make([][]inputFile, len(inputs))
+	outputs := make([][]EpisodeResult, len(inputs))
+	failures := make([][]error, len(inputs))
+	skipped := make([]error, len(inputs))
+	remaining := make([]int, len(inputs)) // Files of each input that haven't finished
+
+	var mu sync.Mutex
+	var failed atomic.Bool
+	skipReason := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p.stopping.Load() {
+			return ErrStopped
+		}
+		if !p.ContinueOnError && failed.Load() {
+			return ErrSkipped
+		}
+		return nil
+	}
+	inputErr := func(i int) error {
+		if err := errors.Join(failures[i]...); err != nil {
+			return err
+		}
+		return skipped[i]
+	}
+	finishInput := func(i int) {
+		mu.Lock()
+		err := inputErr(i)
+		mu.Unlock()
+		p.emit(Event{Type: EventInputFinished, Input: inputs[i], InputIndex: i, Inputs: len(inputs), Err: err})
+	}
+
+	// Start workers
+	jobs := make(chan episodeJob)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < p.getWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				input := inputs[job.inputIndex]
+				var output, digest string
+				reason := skipReason()
+				err := reason
+				if reason == nil {
+					output, digest, err = p.doFile(ctx, input, job)
+				}
+
+				mu.Lock()
+				switch {
+				case reason != nil:
+					skipped[job.inputIndex] = reason
+				case err != nil:
+					failed.Store(true)
+					failures[job.inputIndex] = append(failures[job.inputIndex], err)
+				default:
+					outputs[job.inputIndex][job.index] = EpisodeResult{Output: output, SHA256: digest}
+				}
+				remaining[job.inputIndex]--
+				inputDone := remaining[job.inputIndex] == 0
+				mu.Unlock()
+
+				event := job.event(input)
+				event.Type = EventFileFinished
+				event.Output = output
+				event.Err = err
+				p.emit(event)
+				if inputDone {
+					finishInput(job.inputIndex)
+				}
+			}
+		}()
+	}
+
+	// Split inputs and queue up the resulting episodes
+	numberer := p.newEpisodeNumberer()
+	for i, input := range inputs {
+		if reason := skipReason(); reason != nil {
+			mu.Lock()
+			skipped[i] = reason
+			mu.Unlock()
+			finishInput(i)
+			continue
+		}
+
+		event := Event{Input: input, InputIndex: i, Inputs: len(inputs)}
+		started := event
+		started.Type = EventInputStarted
+		p.emit(started)
+
+		failInput := func(err error) {
+			mu.Lock()
+			failed.Store(true)
+			failures[i] = append(failures[i], err)
+			mu.Unlock()
+			finishInput(i)
+		}
+		if err := numberer.checkInput(input); err != nil {
+			p.Logger.Errorw("error while numbering episodes", "input", input, "err", err)
+			failInput(err)
+			continue
+		}
+
+		inputFiles, transcode, err := p.prepareInput(ctx, event)
 		if err != nil {
-			p.Logger.Errorw("error while splitting video", "err", err)
-			return nil, err
+			// An unsplit input is always a single episode, unless it could have been an extra
+			count := -1
+			if p.Split == nil && p.ExtraMaxLength == 0 {
+				count = 1
+			}
+			numberer.skipInput(input, count)
+			failInput(err)
+			continue
+		}
+
+		mu.Lock()
+		files[i] = inputFiles
+		outputs[i] = make([]EpisodeResult, len(inputFiles))
+		remaining[i] = len(inputFiles)
+		mu.Unlock()
+		if len(inputFiles) == 0 {
+			finishInput(i)
+			continue
+		}
+		numberer.startInput(input)
+
+		// Episode numbers follow split order, even if an episode fails
+		media := p.assignMedia(numberer, inputFiles)
+		for j, file := range inputFiles {
+			jobs <- episodeJob{
+				file:       file,
+				index:      j,
+				episodes:   len(inputFiles),
+				inputIndex: i,
+				inputs:     len(inputs),
+				media:      media[j],
+				transcode:  transcode,
+			}
 		}
 	}
+	close(jobs)
+	wg.Wait()
+
+	// Carry on numbering from here the next time the pipeline runs
+	if next := numberer.nextEpisode(); next > 0 {
+		p.Media.Episode = next
+	}
 
-	outputs := make([]string, 0)
-	for _, file := range files {
-		var results *tasks.AnalyzeResults
-		if p.Analyze != nil {
-			results, err = p.Analyze.Do(context.TODO(), file)
+	for i, input := range inputs {
+		results[i].Input = input
+		for j, episode := range outputs[i] {
+			episode.File = files[i][j].name
+			results[i].Episodes = append(results[i].Episodes, episode)
+			if episode.Output != "" {
+				results[i].Outputs = append(results[i].Outputs, episode.Output)
+			}
+		}
+
+		results[i].Err = inputErr(i)
+	}
+
+	return results
+}
+
+// Stop lets episodes that are already running finish, but keeps the pipeline from starting anything new.
+// Cancel the context given to Do or DoAll to abort running episodes as well.
+func (p *Pipeline) Stop() {
+	p.stopping.Store(true)
+}
+
+// prepareInput splits an input if needed, and returns the files to process along with the transcode task for them.
+// Every input gets its own scratch directory, so files from different inputs can be processed at the same time.
+func (p *Pipeline) prepareInput(ctx context.Context, event Event) ([]inputFile, *tasks.TranscodeVideo, error) {
+	input := event.Input
+	workDir := getInputWorkDir(event.InputIndex)
+
+	transcode := *p.Transcode
+	transcode.WorkDir = filepath.Join(p.Transcode.WorkDir, workDir)
+	if err := os.MkdirAll(transcode.WorkDir, 0750); err != nil {
+		return nil, nil, &StageError{Input: input, Stage: StageTranscode, Err: err}
+	}
+
+	// Split the input file into multiple files
+	if p.Split == nil {
+		file := inputFile{name: input}
+		if p.ExtraMaxLength > 0 {
+			// Finding extras needs the length of the file before it can be numbered
+			event.File = input
+			length, err := p.readLength(ctx, event)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
+			}
+			file.length = length
+		}
+		return []inputFile{file}, &transcode, nil
+	}
+
+	if episodes, ok := p.Journal.getSplit(input); ok {
+		p.Logger.Infow("reusing split output from journal", "input", input, "files", len(episodes))
+		return newSplitInputFiles(episodes), &transcode, nil
+	}
+
+	split := *p.Split
+	split.WorkDir = filepath.Join(p.Split.WorkDir, workDir)
+	if err := os.MkdirAll(split.WorkDir, 0750); err != nil {
+		return nil, nil, &StageError{Input: input, Stage: StageSplit, Err: err}
+	}
+
+	event.File = input
+	finishStage := p.startStage(event, StageSplit)
+	episodes, err := split.DoEpisodes(ctx, input)
+	finishStage(err)
+	if err != nil {
+		p.Logger.Errorw("error while splitting video", "err", err)
+		return nil, nil, &StageError{Input: input, Stage: StageSplit, Err: err}
+	}
+	p.recordJournal(p.Journal.setSplit(input, episodes))
+
+	return newSplitInputFiles(episodes), &transcode, nil
+}
+
+func newSplitInputFiles(episodes []tasks.SplitEpisode) []inputFile {
+	files := make([]inputFile, len(episodes))
+	for i, episode := range episodes {
+		files[i] = inputFile{name: episode.Filename, length: episode.Length}
+	}
+	return files
+}
+
+// analyzeFile returns the analysis of the file of event from the journal, or runs the analyze task
+func (p *Pipeline) analyzeFile(ctx context.Context, event Event) (*tasks.AnalyzeResults, error) {
+	input, file := event.Input, event.File
+	if results, ok := p.Journal.getAnalyze(input, file); ok {
+		return results, nil
+	}
+
+	finishStage := p.startStage(event, StageAnalyze)
+	results, err := p.Analyze.Do(ctx, file)
+	finishStage(err)
+	if err != nil {
+		p.Logger.Errorw("error while analyzing video", "err", err)
+		return nil, &StageError{Input: input, File: file, Stage: StageAnalyze, Err: err}
+	}
+	p.recordJournal(p.Journal.setAnalyze(input, file, results))
+
+	return results, nil
+}
+
+// readLength returns the length of the file of event.  The container duration is all that's needed, which is much
+// quicker to read than a full analysis, since that counts every frame.
+func (p *Pipeline) readLength(ctx context.Context, event Event) (time.Duration, error) {
+	results, err := p.probeFile(ctx, event)
+	if err != nil {
+		return 0, err
+	}
+	return results.Duration, nil
+}
+
+// probeFile reads the stream details and container duration of the file of event, without counting frames
+func (p *Pipeline) probeFile(ctx context.Context, event Event) (*tasks.AnalyzeResults, error) {
+	input, file := event.Input, event.File
+	if results, ok := p.Journal.getAnalyze(input, file); ok {
+		return results, nil
+	}
+
+	probe := &tasks.AnalyzeVideo{
+		Logger:           p.Logger,
+		SkipFrameCount:   true,
+		UseLowerPriority: p.Transcode.UseLowerPriority,
+	}
+	results, err := probe.Do(ctx, file)
+	if err != nil {
+		p.Logger.Errorw("error while probing video", "err", err)
+		return nil, &StageError{Input: input, File: file, Stage: StageAnalyze, Err: err}
+	}
+
+	return results, nil
+}
+
+// doFile runs the analyze, transcode and copy stages for a single file, and returns the output along with its digest
+// if it was computed while copying
+func (p *Pipeline) doFile(ctx context.Context, input string, job episodeJob) (string, string, error) {
+	file := job.file.name
+	if output, ok := p.Journal.getOutput(input, file); ok {
+		p.Logger.Infow("skipping file already completed in journal", "file", file, "output", output)
+		return output, "", nil
+	}
+
+	media := job.media
+	media.SourceFilename = strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	media.SplitIndex = job.index + 1
+
+	// Existing outputs that will be kept anyway don't need transcoding, as long as the output name doesn't depend on
+	// the transcoded file
+	policy := p.getCollisionPolicy()
+	if (policy == CollisionSkip || policy == CollisionFail) && !naming.NeedsStreamInfo(p.Library) {
+		if output, err := p.resolveOutputPath(job.transcode.GetOutputFilename(file), media); err == nil {
+			if existing, done, err := p.checkCollision(output, 0); done {
+				if err != nil {
+					p.Logger.Errorw("error while checking for an existing output", "err", err)
+					return "", "", &StageError{Input: input, File: file, Stage: StageCopy, Err: err}
+				}
+				p.recordJournal(p.Journal.setOutput(input, file, existing))
+				return existing, "", nil
 			}
 		}
+	}
+
+	var results *tasks.AnalyzeResults
+	if p.Analyze != nil {
+		var err error
+		results, err = p.analyzeFile(ctx, job.event(input))
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	// Transcode each file from the split
+	transcoded, ok := p.Journal.getTranscoded(input, file)
+	if !ok {
+		release, err := p.checkEpisodeSpace(job.transcode, file, results)
+		if err != nil {
+			p.Logger.Errorw("error while checking free disk space", "err", err)
+			return "", "", &StageError{Input: input, File: file, Stage: StageTranscode, Err: err}
+		}
+		defer release()
+
+		// Each file gets its own copy of the task, so progress is reported for the right file
+		transcode := *job.transcode
+		progress := job.event(input)
+		progress.Type = EventProgress
+		progress.Stage = StageTranscode
+		transcode.OnProgress = func(report tasks.TranscodeProgress) {
+			progress.Progress = report
+			p.emit(progress)
+		}
 
-		// Transcode each file from the split
-		transcoded, err := p.Transcode.Do(context.TODO(), file, results)
+		finishStage := p.startStage(job.event(input), StageTranscode)
+		transcoded, err = transcode.Do(ctx, file, results)
+		finishStage(err)
 		if err != nil {
 			p.Logger.Errorw("error while transcoding video", "err", err)
-			return nil, err
+			return "", "", &StageError{Input: input, File: file, Stage: StageTranscode, Err: err}
 		}
+		p.recordJournal(p.Journal.setTranscoded(input, file, transcoded))
+	} else {
+		p.Logger.Infow("reusing transcoded file from journal", "file", file, "transcoded", transcoded)
+	}
 
-		// Copy the output file
-		output := p.getOutputPath(transcoded)
-		if err := copyFile(transcoded, output); err != nil {
-			p.Logger.Errorw("error while copying video to output dir", "err", err)
-			return nil, err
+	// Check the transcoded file before it gets anywhere near the output dir.  The input is never touched, so a failed
+	// file can simply be transcoded again.
+	if p.Verify != nil {
+		finishStage := p.startStage(job.event(input), StageVerify)
+		err := p.Verify.Do(ctx, transcoded, results, job.transcode.Options)
+		finishStage(err)
+		if err != nil {
+			p.Logger.Errorw("error while verifying transcoded video", "transcoded", transcoded, "err", err)
+			p.recordJournal(p.Journal.clearTranscoded(input, file))
+			return "", "", &StageError{Input: input, File: file, Stage: StageVerify, Err: err}
 		}
-		outputs = append(outputs, output)
-		p.Plex.Episode += 1
 	}
 
-	return outputs, nil
+	// Copy the output file
+	if naming.NeedsStreamInfo(p.Library) {
+		p.setMediaStreamInfo(ctx, &media, transcoded)
+	}
+
+	output, err := p.getOutputPath(transcoded, media)
+	if err != nil {
+		p.Logger.Errorw("error while naming output", "err", err)
+		return "", "", &StageError{Input: input, File: file, Stage: StageCopy, Err: err}
+	}
+	finishStage := p.startStage(job.event(input), StageCopy)
+	output, digest, err := p.placeOutput(transcoded, output)
+	finishStage(err)
+	if err != nil {
+		p.Logger.Errorw("error while copying video to output dir", "err", err)
+		return "", "", &StageError{Input: input, File: file, Stage: StageCopy, Err: err}
+	}
+	p.recordJournal(p.Journal.setOutput(input, file, output))
+
+	return output, digest, nil
 }
 
-func (p *Pipeline) getOutputPath(name string) string {
-	if !p.Plex.Enabled {
-		// Just copy the result to the output dir with the same name
-		return filepath.Join(p.OutputDir, filepath.Base(name))
+// recordJournal logs errors from writing to the journal.  These aren't fatal, since they only affect resuming.
+func (p *Pipeline) recordJournal(err error) {
+	if err != nil {
+		p.Logger.Warnw("error while writing journal", "err", err)
 	}
+}
 
-	// We have a little bit of extra work to do if we want plex naming
-	outPath := filepath.Join(p.OutputDir, p.getPlexPath())
+// getInputWorkDir returns the name of the scratch directory for an input, relative to a task work dir
+func getInputWorkDir(index int) string {
+	return fmt.Sprintf("input-%03d", index)
+}
+
+func (p *Pipeline) getWorkers() int {
+	if p.Workers < 1 {
+		return 1
+	}
+	return p.Workers
+}
+
+func (p *Pipeline) getOutputPath(name string, media naming.Media) (string, error) {
+	outPath, err := p.resolveOutputPath(name, media)
+	if err != nil || p.Library == nil {
+		return outPath, err
+	}
+
+	// We have a little bit of extra work to do if we want library naming
 	if err := os.MkdirAll(filepath.Dir(outPath), 0750); err != nil {
-		p.Logger.Errorw("error while creating plex output dir", "err", err)
-		return ""
+		p.Logger.Errorw("error while creating library output dir", "err", err)
+		return "", err
 	}
 
-	return outPath
+	return outPath, nil
 }
 
-func (p *Pipeline) getPlexPath() string {
-	plex := p.Plex
+// resolveOutputPath returns where the transcoded file name should be copied to, without creating any directories
+func (p *Pipeline) resolveOutputPath(name string, media naming.Media) (string, error) {
+	if p.Library == nil {
+		// Just copy the result to the output dir with the same name
+		return filepath.Join(p.OutputDir, filepath.Base(name)), nil
+	}
 
-	plexName := plex.Name
-	if plex.Year > 0 {
-		plexName = fmt.Sprintf("%s (%d)", plex.Name, plex.Year)
+	media = naming.SanitizeMedia(media)
+	media.Extension = filepath.Ext(name)
+	libraryPath, err := p.Library.Path(media)
+	if err != nil {
+		return "", err
 	}
 
-	// TODO: Add validation somewhere to enforce checking for these
-	switch plex.MediaType {
-	case "movie":
-		return fmt.Sprintf("%s/%s.mkv", plexName, plexName)
-	case "tv":
-		return fmt.Sprintf(
-			"%s/Season %02d/%s - s%02de%02d.mkv",
-			plexName,
-			plex.Season,
-			plexName,
-			plex.Season,
-			plex.Episode)
+	return filepath.Join(p.OutputDir, naming.SanitizePath(libraryPath)), nil
+}
+
+// setMediaStreamInfo fills in the stream details of media by probing the transcoded file.  Naming can still go ahead
+// without them, so errors are only logged.
+func (p *Pipeline) setMediaStreamInfo(ctx context.Context, media *naming.Media, transcoded string) {
+	probe := &tasks.AnalyzeVideo{
+		Logger:         p.Logger,
+		SkipFrameCount: true,
 	}
 
-	return "unknown.mkv"
+	results, err := probe.Do(ctx, transcoded)
+	if err != nil {
+		p.Logger.Warnw("error while probing transcoded file for naming", "file", transcoded, "err", err)
+		return
+	}
+
+	if video := results.FirstStream("video"); video != nil {
+		media.HDR = video.HDR
+		media.Resolution = naming.ResolutionLabel(video.Width, video.Height)
+		media.VideoCodec = video.Codec
+	}
+	if audio := results.FirstStream("audio"); audio != nil {
+		media.AudioCodec = audio.Codec
+	}
 }
@@ -0,0 +1,128 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/tasks"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// InputPlan describes the work the pipeline would do for a single input
+type InputPlan struct {
+	Input    string           `json:"input"`
+	Split    *tasks.SplitPlan `json:"split,omitempty"`
+	Episodes []EpisodePlan    `json:"episodes"`
+}
+
+// EpisodePlan describes how a single file would be transcoded, and where the result would be stored
+type EpisodePlan struct {
+	File       string   `json:"file"`            // File given to the transcoder, which is a split output when splitting
+	Episode    int      `json:"episode"`         // Episode number used for library naming
+	Extra      string   `json:"extra,omitempty"` // Extra type, if the file is named as an extra
+	Command    string   `json:"command"`         // Transcoder command
+	Args       []string `json:"args"`            // Transcoder arguments
+	Transcoded string   `json:"transcoded"`      // Intermediate file written by the transcoder
+	Output     string   `json:"output"`          // Final output path
+}
+
+// Plan probes every input and works out what Do would produce, without splitting, transcoding, copying or creating
+// any directories.  Inputs are only probed for their streams and container duration, since counting frames decodes the
+// whole file.  Split episodes don't exist yet, so they aren't analyzed, and transcoder arguments that depend on
+// analysis (such as the matroska index space) may differ from a real run.  For the same reason, stream details used by
+// name templates are left empty.
+func (p *Pipeline) Plan(ctx context.Context, inputs []string) ([]InputPlan, error) {
+	plans := make([]InputPlan, 0, len(inputs))
+	numberer := p.newEpisodeNumberer()
+	for i, input := range inputs {
+		plan := InputPlan{Input: input}
+		transcode := *p.Transcode
+		transcode.WorkDir = filepath.Join(p.Transcode.WorkDir, getInputWorkDir(i))
+
+		var files []inputFile
+		var results *tasks.AnalyzeResults
+		if p.Split != nil {
+			split := *p.Split
+			split.WorkDir = filepath.Join(p.Split.WorkDir, getInputWorkDir(i))
+
+			splitPlan, err := split.Plan(ctx, input)
+			if err != nil {
+				return nil, &StageError{Input: input, Stage: StageSplit, Err: err}
+			}
+			plan.Split = splitPlan
+			for j, name := range split.GetOutputFilenames(len(splitPlan.Episodes)) {
+				files = append(files, inputFile{name: name, length: splitPlan.Episodes[j].Length})
+			}
+		} else {
+			event := Event{Input: input, InputIndex: i, Inputs: len(inputs), File: input}
+			file := inputFile{name: input}
+			if p.Analyze != nil || p.ExtraMaxLength > 0 {
+				probed, err := p.probeFile(ctx, event)
+				if err != nil {
+					return nil, err
+				}
+				file.length = probed.Duration
+				if p.Analyze != nil {
+					results = probed
+				}
+			}
+			files = append(files, file)
+		}
+
+		numberer.startInput(input)
+		assigned := p.assignMedia(numberer, files)
+		for j, f := range files {
+			file := f.name
+			media := assigned[j]
+			media.SourceFilename = strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+			media.SplitIndex = j + 1
+
+			command, args, transcoded, err := transcode.Plan(file, results)
+			if err != nil {
+				return nil, &StageError{Input: input, File: file, Stage: StageTranscode, Err: err}
+			}
+
+			output, err := p.resolveOutputPath(transcoded, media)
+			if err != nil {
+				return nil, &StageError{Input: input, File: file, Stage: StageCopy, Err: err}
+			}
+
+			plan.Episodes = append(plan.Episodes, EpisodePlan{
+				File:       file,
+				Episode:    media.Episode,
+				Extra:      media.Extra,
+				Command:    command,
+				Args:       args,
+				Transcoded: transcoded,
+				Output:     output,
+			})
+		}
+
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
+
+// WritePlans writes plans in a human-readable format
+func WritePlans(w io.Writer, plans []InputPlan) {
+	for _, plan := range plans {
+		fmt.Fprintf(w, "Input: %s\n", plan.Input)
+		if plan.Split != nil {
+			fmt.Fprintf(w, "  Split into %d episode(s):\n", len(plan.Split.Episodes))
+			for i, episode := range plan.Split.Episodes {
+				fmt.Fprintf(w, "    %d: chapters %d-%d (%s - %s)\n",
+					i+1, episode.FirstChapter, episode.LastChapter, episode.Start, episode.End)
+			}
+		}
+
+		for i, episode := range plan.Episodes {
+			fmt.Fprintf(w, "  Episode %d of %d:\n", i+1, len(plan.Episodes))
+			fmt.Fprintf(w, "    File:    %s\n", episode.File)
+			fmt.Fprintf(w, "    Command: %s %s\n", episode.Command, strings.Join(episode.Args, " "))
+			fmt.Fprintf(w, "    Output:  %s\n", episode.Output)
+		}
+		fmt.Fprintln(w)
+	}
+}
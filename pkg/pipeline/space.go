@@ -0,0 +1,332 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/neptune-media/robin/pkg/tasks"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SpaceCheck decides what happens when a filesystem looks too small for the work ahead
+type SpaceCheck string
+
+const (
+	SpaceCheckOff    SpaceCheck = "off"    // Never checks free space
+	SpaceCheckRefuse SpaceCheck = "refuse" // Fails before starting work that won't fit
+	SpaceCheckWarn   SpaceCheck = "warn"   // Logs a warning, and carries on anyway
+)
+
+// spaceMargin is added to every estimate, for container overhead and estimates that come out low
+const spaceMargin = 0.05
+
+// ErrInsufficientSpace is reported when a filesystem is too small for the work ahead, with the refuse space check
+var ErrInsufficientSpace = errors.New("not enough free disk space")
+
+var spaceChecks = []SpaceCheck{SpaceCheckOff, SpaceCheckRefuse, SpaceCheckWarn}
+
+// ParseSpaceCheck returns the SpaceCheck named by s
+func ParseSpaceCheck(s string) (SpaceCheck, error) {
+	for _, check := range spaceChecks {
+		if string(check) == s {
+			return check, nil
+		}
+	}
+	return "", fmt.Errorf("unknown space check: %s (expected one of %s)", s, strings.Join(SpaceChecks(), ", "))
+}
+
+// SpaceChecks returns the names of every space check
+func SpaceChecks() []string {
+	names := make([]string, len(spaceChecks))
+	for i, check := range spaceChecks {
+		names[i] = string(check)
+	}
+	return names
+}
+
+// SpaceRequirement is the space needed on a single filesystem
+type SpaceRequirement struct {
+	Paths     []string // Directories on the filesystem that will be written to
+	Required  uint64
+	Available uint64
+
+	device uint64
+}
+
+// Sufficient reports whether the filesystem has enough free space
+func (r SpaceRequirement) Sufficient() bool {
+	return r.Available >= r.Required
+}
+
+// EstimateSpace works out how much space processing inputs needs in the work dir and the output dir, and how much is
+// free.  Split episodes and transcoded files are all kept in the work dir until the run finishes, so they add up.
+// Work the journal has already recorded is left out, since its files already take up their space.
+func (p *Pipeline) EstimateSpace(ctx context.Context, inputs []string) ([]SpaceRequirement, error) {
+	var work, output uint64
+	for _, input := range inputs {
+		info, err := os.Stat(input)
+		if err != nil {
+			return nil, err
+		}
+		size := uint64(info.Size())
+
+		remaining := p.remainingWork(input, size)
+		if remaining.transcode == 0 && remaining.store == 0 {
+			continue
+		}
+
+		// Bitrate targets can only be compared with the source after probing it
+		var results *tasks.AnalyzeResults
+		if _, ok := encodingBitrate(p.Transcode.Options.VideoEncodingOptions); ok && remaining.transcode > 0 {
+			probe := &tasks.AnalyzeVideo{Logger: p.Logger, SkipFrameCount: true}
+			results, err = probe.Do(ctx, input)
+			if err != nil {
+				p.Logger.Warnw("error while probing input to estimate space, assuming outputs are as large as inputs",
+					"input", input, "err", err)
+			}
+		}
+
+		transcoded := estimateTranscodedSize(p.Transcode.Options, remaining.transcode, results)
+		if remaining.split {
+			work += size
+		}
+		work += transcoded
+		output += transcoded + remaining.store
+	}
+
+	workReq, err := newSpaceRequirement(p.Transcode.WorkDir, work)
+	if err != nil {
+		return nil, err
+	}
+	outputReq, err := newSpaceRequirement(p.OutputDir, output)
+	if err != nil {
+		return nil, err
+	}
+
+	if workReq.device != outputReq.device {
+		return []SpaceRequirement{workReq, outputReq}, nil
+	}
+
+	// Sharing a filesystem, outputs only take extra space when they're copied
+	if p.Transfer == "" || p.Transfer == TransferCopy {
+		workReq.Required += outputReq.Required
+	}
+	workReq.Paths = append(workReq.Paths, outputReq.Paths...)
+	return []SpaceRequirement{workReq}, nil
+}
+
+// remainingSize is the work left for an input, in bytes
+type remainingSize struct {
+	split     bool   // Set if the input still has to be split
+	transcode uint64 // Size of the files that still have to be transcoded
+	store     uint64 // Size of transcoded files that still have to be stored
+}
+
+// remainingWork returns the work left for input, which has the given size, according to the journal
+func (p *Pipeline) remainingWork(input string, size uint64) remainingSize {
+	files := []string{input}
+	if p.Split != nil {
+		episodes, ok := p.Journal.getSplit(input)
+		if !ok {
+			return remainingSize{split: true, transcode: size}
+		}
+		files = files[:0]
+		for _, episode := range episodes {
+			files = append(files, episode.Filename)
+		}
+	}
+
+	var remaining remainingSize
+	for _, file := range files {
+		if _, ok := p.Journal.getOutput(input, file); ok {
+			continue
+		}
+		if transcoded, ok := p.Journal.getTranscoded(input, file); ok {
+			if info, err := os.Stat(transcoded); err == nil {
+				remaining.store += uint64(info.Size())
+			}
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			remaining.transcode += uint64(info.Size())
+		}
+	}
+	return remaining
+}
+
+// checkEpisodeSpace makes sure there's still room to transcode and store file, since earlier episodes may have turned
+// out larger than estimated, or something else may have used up the space in the meantime.  The estimate stays
+// reserved until release is called, so workers checking at the same time can't all count on the same free space.
+func (p *Pipeline) checkEpisodeSpace(transcode *tasks.TranscodeVideo, file string, results *tasks.AnalyzeResults) (release func(), err error) {
+	release = func() {}
+	if p.SpaceCheck == "" || p.SpaceCheck == SpaceCheckOff {
+		return release, nil
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return release, err
+	}
+	transcoded := estimateTranscodedSize(transcode.Options, uint64(info.Size()), results)
+
+	p.spaceMu.Lock()
+	defer p.spaceMu.Unlock()
+
+	// Dirs on the same filesystem share its free space
+	var requirements []SpaceRequirement
+	for _, dir := range []string{transcode.WorkDir, p.OutputDir} {
+		requirement, err := newSpaceRequirement(dir, transcoded)
+		if err != nil {
+			p.Logger.Warnw("unable to check free disk space", "dir", dir, "err", err)
+			continue
+		}
+		if i := slices.IndexFunc(requirements, func(r SpaceRequirement) bool { return r.device == requirement.device }); i >= 0 {
+			if p.Transfer == "" || p.Transfer == TransferCopy {
+				requirements[i].Required += requirement.Required
+			}
+			requirements[i].Paths = append(requirements[i].Paths, dir)
+			continue
+		}
+		requirement.Available -= min(requirement.Available, p.spaceReserved[requirement.device])
+		requirements = append(requirements, requirement)
+	}
+
+	for _, requirement := range requirements {
+		if requirement.Sufficient() {
+			continue
+		}
+
+		err := fmt.Errorf("%w in %s for %s: %s needed, %s available", ErrInsufficientSpace,
+			strings.Join(requirement.Paths, ", "), file, FormatBytes(requirement.Required), FormatBytes(requirement.Available))
+		if p.SpaceCheck == SpaceCheckRefuse {
+			return release, err
+		}
+		p.Logger.Warnw("continuing with low disk space", "err", err)
+	}
+
+	if p.spaceReserved == nil {
+		p.spaceReserved = make(map[uint64]uint64)
+	}
+	for _, requirement := range requirements {
+		p.spaceReserved[requirement.device] += requirement.Required
+	}
+	return func() {
+		p.spaceMu.Lock()
+		defer p.spaceMu.Unlock()
+		for _, requirement := range requirements {
+			p.spaceReserved[requirement.device] -= requirement.Required
+		}
+	}, nil
+}
+
+// estimateTranscodedSize estimates the size of transcoding a file of the given size, from the "bitrate" targets of the
+// encoding options.  Without targets, or without bitrates from the source to compare them with, the output is
+// assumed to be as large as the source.
+func estimateTranscodedSize(opts tasks.TranscodeVideoOptions, size uint64, results *tasks.AnalyzeResults) uint64 {
+	estimate := float64(size)
+
+	videoTarget, ok := encodingBitrate(opts.VideoEncodingOptions)
+	if ok && results != nil {
+		var sourceRate, videoRate, audioRate float64
+		audioStreams := 0
+		for _, stream := range results.Streams {
+			sourceRate += float64(stream.BitRate)
+			switch stream.Type {
+			case "video":
+				videoRate += float64(stream.BitRate)
+			case "audio":
+				audioRate += float64(stream.BitRate)
+				audioStreams++
+			}
+		}
+
+		targetRate := videoTarget
+		if opts.DiscardAudio {
+			audioRate = 0
+		} else if audioTarget, ok := encodingBitrate(opts.AudioEncodingOptions); ok {
+			if !opts.CopyAllAudioStreams {
+				audioStreams = min(1, audioStreams)
+			}
+			audioRate = audioTarget * float64(audioStreams)
+		}
+		targetRate += audioRate
+
+		if sourceRate > 0 && videoRate > 0 {
+			estimate = float64(size) * targetRate / sourceRate
+		}
+	}
+
+	return uint64(estimate * (1 + spaceMargin))
+}
+
+func newSpaceRequirement(dir string, required uint64) (SpaceRequirement, error) {
+	available, device, err := diskSpace(dir)
+	if err != nil {
+		return SpaceRequirement{}, fmt.Errorf("error while checking free space in %s: %v", dir, err)
+	}
+
+	return SpaceRequirement{
+		Paths:     []string{dir},
+		Required:  required,
+		Available: available,
+		device:    device,
+	}, nil
+}
+
+// encodingBitrate returns the bitrate target from encoding options, in bits per second
+func encodingBitrate(opts map[string]interface{}) (float64, bool) {
+	if codec, _ := opts["codec"].(string); codec == "copy" {
+		return 0, false
+	}
+
+	value, ok := opts["bitrate"]
+	if !ok {
+		return 0, false
+	}
+
+	bitrate, err := parseBitrate(fmt.Sprint(value))
+	return bitrate, err == nil && bitrate > 0
+}
+
+// parseBitrate parses an ffmpeg style bitrate, like 6000000, 640k or 6M
+func parseBitrate(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	multiplier := 1.0
+	if len(s) > 0 {
+		switch s[len(s)-1] {
+		case 'k', 'K':
+			multiplier = 1e3
+		case 'm', 'M':
+			multiplier = 1e6
+		case 'g', 'G':
+			multiplier = 1e9
+		}
+		if multiplier != 1 {
+			s = s[:len(s)-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid bitrate: %s", s)
+	}
+	return value * multiplier, nil
+}
+
+// FormatBytes formats a size with binary units, like 1.5 GiB
+func FormatBytes(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
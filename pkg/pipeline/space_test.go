@@ -0,0 +1,187 @@
+package pipeline
+
+import (
+	"errors"
+	"github.com/neptune-media/robin/pkg/tasks"
+	"go.uber.org/zap"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseBitrate(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    float64
+		wantErr bool
+	}{
+		{s: "6000000", want: 6e6},
+		{s: "640k", want: 640e3},
+		{s: "6M", want: 6e6},
+		{s: "1.5G", want: 1.5e9},
+		{s: "fast", wantErr: true},
+		{s: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseBitrate(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBitrate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseBitrate() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateTranscodedSize(t *testing.T) {
+	const size = 1000000
+	results := &tasks.AnalyzeResults{Streams: []tasks.StreamInfo{
+		{Type: "video", BitRate: 8000000},
+		{Type: "audio", BitRate: 1000000},
+		{Type: "audio", BitRate: 1000000},
+	}}
+
+	tests := []struct {
+		name    string
+		opts    tasks.TranscodeVideoOptions
+		results *tasks.AnalyzeResults
+		want    uint64
+	}{
+		{
+			name:    "no bitrate target",
+			opts:    tasks.TranscodeVideoOptions{VideoEncodingOptions: map[string]interface{}{"codec": "libx265"}},
+			results: results,
+			want:    1050000,
+		},
+		{
+			name:    "copied video",
+			opts:    tasks.TranscodeVideoOptions{VideoEncodingOptions: map[string]interface{}{"codec": "copy", "bitrate": "1M"}},
+			results: results,
+			want:    1050000,
+		},
+		{
+			name:    "video target keeps audio",
+			opts:    tasks.TranscodeVideoOptions{VideoEncodingOptions: map[string]interface{}{"bitrate": "3M"}},
+			results: results,
+			want:    525000,
+		},
+		{
+			name: "video and audio targets",
+			opts: tasks.TranscodeVideoOptions{
+				AudioEncodingOptions: map[string]interface{}{"bitrate": "500k"},
+				VideoEncodingOptions: map[string]interface{}{"bitrate": 4500000},
+			},
+			results: results,
+			want:    525000,
+		},
+		{
+			name:    "discarded audio",
+			opts:    tasks.TranscodeVideoOptions{DiscardAudio: true, VideoEncodingOptions: map[string]interface{}{"bitrate": "5M"}},
+			results: results,
+			want:    525000,
+		},
+		{
+			name: "unknown source bitrate",
+			opts: tasks.TranscodeVideoOptions{VideoEncodingOptions: map[string]interface{}{"bitrate": "3M"}},
+			want: 1050000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimateTranscodedSize(tt.opts, size, tt.results); got != tt.want {
+				t.Errorf("estimateTranscodedSize() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipeline_remainingWork(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.mkv")
+	writeTestFile(t, input, "the whole input")
+
+	p := &Pipeline{Split: &tasks.SplitVideo{WorkDir: dir}}
+	if got, want := p.remainingWork(input, 15), (remainingSize{split: true, transcode: 15}); got != want {
+		t.Errorf("remainingWork() without a journal got = %+v, want %+v", got, want)
+	}
+
+	// One episode is stored, one is transcoded and one hasn't been started
+	j, err := OpenJournal(filepath.Join(dir, JournalFilename), JournalSettings{})
+	if err != nil {
+		t.Fatalf("OpenJournal() error = %v", err)
+	}
+	var episodes []tasks.SplitEpisode
+	for _, name := range []string{"stored.mkv", "transcoded.mkv", "pending.mkv"} {
+		episode := filepath.Join(dir, name)
+		writeTestFile(t, episode, "episode")
+		episodes = append(episodes, tasks.SplitEpisode{Filename: episode, Length: time.Minute})
+	}
+	if err := j.setSplit(input, episodes); err != nil {
+		t.Fatalf("setSplit() error = %v", err)
+	}
+	output := filepath.Join(dir, "output.mkv")
+	writeTestFile(t, output, "output")
+	if err := j.setOutput(input, episodes[0].Filename, output); err != nil {
+		t.Fatalf("setOutput() error = %v", err)
+	}
+	transcoded := filepath.Join(dir, "transcoded-output.mkv")
+	writeTestFile(t, transcoded, "transcoded")
+	if err := j.setTranscoded(input, episodes[1].Filename, transcoded); err != nil {
+		t.Fatalf("setTranscoded() error = %v", err)
+	}
+
+	p.Journal = j
+	if got, want := p.remainingWork(input, 15), (remainingSize{transcode: 7, store: 10}); got != want {
+		t.Errorf("remainingWork() got = %+v, want %+v", got, want)
+	}
+}
+
+func TestPipeline_checkEpisodeSpace(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "episode.mkv")
+	writeTestFile(t, file, "episode")
+	available, device, err := diskSpace(dir)
+	if err != nil {
+		t.Skipf("checking free space isn't supported: %v", err)
+	}
+
+	p := &Pipeline{Logger: zap.NewNop().Sugar(), OutputDir: dir, SpaceCheck: SpaceCheckRefuse}
+	transcode := &tasks.TranscodeVideo{WorkDir: dir}
+	release, err := p.checkEpisodeSpace(transcode, file, nil)
+	if err != nil {
+		t.Fatalf("checkEpisodeSpace() error = %v", err)
+	}
+	if p.spaceReserved[device] == 0 {
+		t.Errorf("checkEpisodeSpace() didn't reserve any space")
+	}
+
+	// Space reserved by another worker isn't available
+	p.spaceReserved[device] += available
+	if _, err := p.checkEpisodeSpace(transcode, file, nil); !errors.Is(err, ErrInsufficientSpace) {
+		t.Errorf("checkEpisodeSpace() error = %v, want %v", err, ErrInsufficientSpace)
+	}
+	p.spaceReserved[device] -= available
+
+	release()
+	if p.spaceReserved[device] != 0 {
+		t.Errorf("release() left %d bytes reserved", p.spaceReserved[device])
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		size uint64
+		want string
+	}{
+		{size: 512, want: "512 B"},
+		{size: 1536, want: "1.5 KiB"},
+		{size: 40 << 30, want: "40.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.size); got != tt.want {
+			t.Errorf("FormatBytes(%d) got = %v, want %v", tt.size, got, tt.want)
+		}
+	}
+}
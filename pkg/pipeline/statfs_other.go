@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package pipeline
+
+import "errors"
+
+// diskSpace is only supported on linux, macOS and FreeBSD
+func diskSpace(path string) (available, device uint64, err error) {
+	return 0, 0, errors.New("checking free disk space is not supported on this platform")
+}
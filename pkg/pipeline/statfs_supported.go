@@ -0,0 +1,21 @@
+//go:build linux || darwin || freebsd
+
+package pipeline
+
+import "golang.org/x/sys/unix"
+
+// diskSpace returns the space available to unprivileged users on the filesystem holding path, and the id of the
+// device it's on
+func diskSpace(path string) (available, device uint64, err error) {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(path, &fs); err != nil {
+		return 0, 0, err
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, 0, err
+	}
+
+	return uint64(fs.Bavail) * uint64(fs.Bsize), uint64(st.Dev), nil
+}
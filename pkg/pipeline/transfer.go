@@ -0,0 +1,157 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TransferMode decides how transcoded files are moved into the output dir
+type TransferMode string
+
+const (
+	TransferCopy     TransferMode = "copy"     // Copies the file, leaving the transcoded file in the work dir
+	TransferHardlink TransferMode = "hardlink" // Links the file into the output dir, falling back to a copy across devices
+	TransferMove     TransferMode = "move"     // Renames the file into the output dir, falling back to a copy across devices
+	TransferReflink  TransferMode = "reflink"  // Clones the file on filesystems that support it (btrfs, xfs), falling back to a copy
+)
+
+var transferModes = []TransferMode{
+	TransferCopy,
+	TransferHardlink,
+	TransferMove,
+	TransferReflink,
+}
+
+// ParseTransferMode returns the TransferMode named by s
+func ParseTransferMode(s string) (TransferMode, error) {
+	for _, mode := range transferModes {
+		if string(mode) == s {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown transfer mode: %s (expected one of %s)", s, strings.Join(TransferModes(), ", "))
+}
+
+// TransferModes returns the names of every transfer mode
+func TransferModes() []string {
+	names := make([]string, len(transferModes))
+	for i, mode := range transferModes {
+		names[i] = string(mode)
+	}
+	return names
+}
+
+// partialFile is a transferred file, waiting to be renamed to its final name
+type partialFile struct {
+	name   string
+	sha256 string // Digest of the file, if it was computed while copying
+	moved  bool   // Set when the source was renamed to the partial file, which is then the only copy of it
+}
+
+// transferToPartial moves source to a temporary ".partial" file next to dest using the transfer mode.  The partial
+// file keeps the permissions and modification time of source, and is synced to disk before returning in every mode,
+// since the transcoder never syncs its output.
+func (p *Pipeline) transferToPartial(source, dest string) (partialFile, error) {
+	mode := p.Transfer
+	if mode == "" {
+		mode = TransferCopy
+	}
+
+	if mode == TransferCopy {
+		name, digest, err := copyToPartial(p.Logger, source, dest)
+		return partialFile{name: name, sha256: digest}, err
+	}
+
+	// Reserve a unique partial name, which the rename, link or clone then takes over
+	name, err := reservePartial(dest)
+	if err != nil {
+		return partialFile{}, err
+	}
+
+	switch mode {
+	case TransferHardlink:
+		os.Remove(name)
+		err = os.Link(source, name)
+	case TransferMove:
+		err = os.Rename(source, name)
+	case TransferReflink:
+		err = reflinkFile(source, name)
+	}
+	if err == nil {
+		partial := partialFile{name: name, moved: mode == TransferMove}
+		if err := syncFile(name); err != nil {
+			p.discardPartial(partial, source)
+			return partialFile{}, err
+		}
+		return partial, nil
+	}
+
+	os.Remove(name)
+	p.Logger.Warnw("falling back to copying output", "mode", mode, "source", source, "err", err)
+	name, digest, err := copyToPartial(p.Logger, source, dest)
+	return partialFile{name: name, sha256: digest}, err
+}
+
+// discardPartial gets rid of a partial file that won't be placed.  A moved partial file is the only copy of the
+// transcoded file, so it's renamed back to source instead, where a resumed run can still find it.
+func (p *Pipeline) discardPartial(partial partialFile, source string) {
+	if !partial.moved {
+		os.Remove(partial.name)
+		return
+	}
+
+	if err := os.Rename(partial.name, source); err != nil {
+		p.Logger.Errorw("error while returning transcoded file to the work dir", "partial", partial.name,
+			"source", source, "err", err)
+	}
+}
+
+// reservePartial creates an empty, uniquely named ".partial" file next to dest
+func reservePartial(dest string) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".*.partial")
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// reflinkFile clones source into the existing file dest, sharing their data blocks
+func reflinkFile(source, dest string) (err error) {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	if err := cloneFile(out, in); err != nil {
+		return err
+	}
+	if err := preserveAttributes(in, out); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+// preserveAttributes copies the permissions and modification time of in to out
+func preserveAttributes(in, out *os.File) error {
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(out.Name(), info.ModTime(), info.ModTime())
+}
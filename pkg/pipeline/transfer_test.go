@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPipeline_transferToPartial(t *testing.T) {
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, mode := range transferModes {
+		t.Run(string(mode), func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "source.mkv")
+			writeTestFile(t, source, "transcoded")
+			if err := os.Chmod(source, 0604); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(source, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+
+			// Reflinks aren't supported by most test filesystems, which exercises the fallback instead
+			p := &Pipeline{Logger: zap.NewNop().Sugar(), Transfer: mode}
+			partial, err := p.transferToPartial(source, filepath.Join(dir, "out.mkv"))
+			if err != nil {
+				t.Fatalf("transferToPartial() error = %v", err)
+			}
+
+			content, err := os.ReadFile(partial.name)
+			if err != nil || string(content) != "transcoded" {
+				t.Errorf("partial contents got = %q, %v, want %q", content, err, "transcoded")
+			}
+
+			info, err := os.Stat(partial.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0604 {
+				t.Errorf("partial permissions got = %v, want %v", info.Mode().Perm(), os.FileMode(0604))
+			}
+			if !info.ModTime().Equal(mtime) {
+				t.Errorf("partial mtime got = %v, want %v", info.ModTime(), mtime)
+			}
+
+			if _, err := os.Stat(source); (err == nil) == (mode == TransferMove) {
+				t.Errorf("source exists = %v after %s", err == nil, mode)
+			}
+			if partial.moved != (mode == TransferMove) {
+				t.Errorf("transferToPartial() got moved = %v for %s", partial.moved, mode)
+			}
+
+			// Copies hash the file on the way through
+			const digest = "49c5c49f1d4ab44dc56e36e62d090bd5c999bf82df7c81c88bffa00c08a2b9b4"
+			if mode == TransferCopy && partial.sha256 != digest {
+				t.Errorf("transferToPartial() got sha256 = %v, want %v", partial.sha256, digest)
+			}
+		})
+	}
+}
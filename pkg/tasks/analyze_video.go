@@ -2,6 +2,7 @@ package tasks
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/neptune-media/MediaKit-go/tools/ffprobe"
 	"go.uber.org/zap"
@@ -12,17 +13,32 @@ import (
 
 type AnalyzeVideo struct {
 	Logger           *zap.SugaredLogger
+	SkipFrameCount   bool // Only reads stream details, which is much faster but leaves TotalFrames unset
 	Threads          int
 	UseLowerPriority bool
 	UseThreads       bool
 }
 
 type AnalyzeResults struct {
-	Duration           time.Duration // Length of the video
-	NumAudioStreams    int           // Number of audio streams in source file
-	NumSubtitleStreams int           // Number of subtitle streams in source file
-	NumVideoStreams    int           // Number of video streams in source file
-	TotalFrames        int           // Total number of frames in the video
+	Duration           time.Duration `json:"duration"`             // Length of the video, from the container if it says.  Written to JSON in seconds
+	NumAudioStreams    int           `json:"num_audio_streams"`    // Number of audio streams in source file
+	NumSubtitleStreams int           `json:"num_subtitle_streams"` // Number of subtitle streams in source file
+	NumVideoStreams    int           `json:"num_video_streams"`    // Number of video streams in source file
+	Streams            []StreamInfo  `json:"streams"`              // Details for every stream in source file
+	TotalFrames        int           `json:"total_frames"`         // Total number of frames in the video
+}
+
+type StreamInfo struct {
+	BitRate       int    `json:"bit_rate,omitempty"`       // Bits per second, if known
+	Channels      int    `json:"channels,omitempty"`       // Number of audio channels
+	Codec         string `json:"codec"`                    // Codec name, as reported by ffprobe
+	ColorTransfer string `json:"color_transfer,omitempty"` // Transfer characteristics of a video stream
+	HDR           bool   `json:"hdr"`                      // Set if the video stream uses an HDR transfer function
+	Height        int    `json:"height,omitempty"`         // Height of a video stream, in pixels
+	Index         int    `json:"index"`                    // Index of the stream in source file
+	Language      string `json:"language,omitempty"`       // Language tag of the stream
+	Type          string `json:"type"`                     // One of audio, subtitle, video, etc
+	Width         int    `json:"width,omitempty"`          // Width of a video stream, in pixels
 }
 
 func (t *AnalyzeVideo) Do(ctx context.Context, inputFilename string) (*AnalyzeResults, error) {
@@ -33,7 +49,7 @@ func (t *AnalyzeVideo) Do(ctx context.Context, inputFilename string) (*AnalyzeRe
 	logger.Infow("reading video data")
 	probe := &ffprobe.FFProbe{
 		Filename:      inputFilename,
-		GetFrameCount: true,
+		GetFrameCount: !t.SkipFrameCount,
 		LowPriority:   t.UseLowerPriority,
 		Threads:       t.Threads,
 		UseThreads:    t.UseThreads,
@@ -59,9 +75,16 @@ func (t *AnalyzeVideo) Do(ctx context.Context, inputFilename string) (*AnalyzeRe
 
 	totalFrames, _ := strconv.Atoi(videoStream.NbReadFrames)
 	results := &AnalyzeResults{TotalFrames: totalFrames}
-	err = results.SetDurationFromFramerateString(videoStream.AvgFrameRate)
+	// The container duration is precise, and is what a quick probe of a transcoded file reports, so durations from
+	// either kind of probe can be compared.  Counting frames is only a fallback.
+	if seconds, parseErr := parseStringToFloat(output.Format.Duration); parseErr == nil && seconds > 0 {
+		results.Duration = time.Duration(seconds * float64(time.Second))
+	} else if !t.SkipFrameCount {
+		err = results.SetDurationFromFramerateString(videoStream.AvgFrameRate)
+	}
 
 	for _, stream := range output.Streams {
+		results.Streams = append(results.Streams, newStreamInfo(stream))
 		switch stream.CodecType {
 		case "audio":
 			results.NumAudioStreams++
@@ -83,16 +106,87 @@ func (t *AnalyzeVideo) Do(ctx context.Context, inputFilename string) (*AnalyzeRe
 	return results, err
 }
 
+// Resolution returns the size of the first video stream, as WIDTHxHEIGHT
+func (r *AnalyzeResults) Resolution() string {
+	if stream := r.FirstStream("video"); stream != nil {
+		return fmt.Sprintf("%dx%d", stream.Width, stream.Height)
+	}
+	return ""
+}
+
+// FirstStream returns the first stream of the given type, or nil if there isn't one
+func (r *AnalyzeResults) FirstStream(streamType string) *StreamInfo {
+	for i := range r.Streams {
+		if r.Streams[i].Type == streamType {
+			return &r.Streams[i]
+		}
+	}
+	return nil
+}
+
+// MarshalJSON writes Duration as seconds, since nanoseconds are awkward for anything reading the JSON
+func (r AnalyzeResults) MarshalJSON() ([]byte, error) {
+	type results AnalyzeResults
+	return json.Marshal(struct {
+		results
+		Duration float64 `json:"duration"`
+	}{results(r), r.Duration.Seconds()})
+}
+
+// UnmarshalJSON reads Duration as seconds
+func (r *AnalyzeResults) UnmarshalJSON(data []byte) error {
+	type results AnalyzeResults
+	var decoded struct {
+		results
+		Duration float64 `json:"duration"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*r = AnalyzeResults(decoded.results)
+	r.Duration = time.Duration(decoded.Duration * float64(time.Second))
+	return nil
+}
+
 func (r *AnalyzeResults) SetDurationFromFramerateString(framerate string) error {
 	fps, err := parseStringToFloat(framerate)
 	if err != nil {
 		return err
 	}
 
-	r.Duration = time.Duration(float64(r.TotalFrames)/fps) * time.Second
+	r.Duration = time.Duration(float64(r.TotalFrames) / fps * float64(time.Second))
 	return nil
 }
 
+func newStreamInfo(stream ffprobe.Stream) StreamInfo {
+	info := StreamInfo{
+		Channels:      stream.Channels,
+		Codec:         stream.CodecName,
+		ColorTransfer: stream.ColorTransfer,
+		Height:        stream.Height,
+		Index:         stream.Index,
+		Language:      stream.Tags["language"],
+		Type:          stream.CodecType,
+		Width:         stream.Width,
+	}
+
+	// Matroska files usually only have the bit rate in the statistics tags written by mkvmerge
+	bitRate := stream.BitRate
+	if bitRate == "" {
+		bitRate = stream.Tags["BPS"]
+	}
+	info.BitRate, _ = strconv.Atoi(bitRate)
+
+	// PQ (HDR10, Dolby Vision) and HLG
+	switch stream.ColorTransfer {
+	case "smpte2084", "arib-std-b67":
+		info.HDR = true
+	}
+
+	return info
+}
+
 func parseStringToFloat(s string) (float64, error) {
 	parts := strings.Split(s, "/")
 
@@ -1,6 +1,8 @@
 package tasks
 
 import (
+	"encoding/json"
+	"github.com/neptune-media/MediaKit-go/tools/ffprobe"
 	"testing"
 	"time"
 )
@@ -80,6 +82,16 @@ func TestAnalyzeResults_SetDurationFromFramerateString(t *testing.T) {
 			false,
 			0,
 		},
+		{
+			"fractions of a second are kept",
+			fields{
+				TotalFrames: 36,
+			},
+			args{framerate: "24"},
+			1500 * time.Millisecond,
+			false,
+			0,
+		},
 		{
 			"~10 minutes",
 			fields{
@@ -106,3 +118,87 @@ func TestAnalyzeResults_SetDurationFromFramerateString(t *testing.T) {
 		})
 	}
 }
+
+func TestAnalyzeResults_JSON(t *testing.T) {
+	results := &AnalyzeResults{
+		Duration:        22*time.Minute + 1500*time.Millisecond,
+		NumVideoStreams: 1,
+		Streams:         []StreamInfo{{Codec: "h264", Type: "video"}},
+		TotalFrames:     31686,
+	}
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if fields["duration"] != 1321.5 {
+		t.Errorf("duration got = %v, want 1321.5 seconds", fields["duration"])
+	}
+
+	decoded := &AnalyzeResults{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if decoded.Duration != results.Duration || decoded.TotalFrames != results.TotalFrames || len(decoded.Streams) != 1 {
+		t.Errorf("Unmarshal() got = %+v, want %+v", decoded, results)
+	}
+}
+
+func Test_newStreamInfo(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream ffprobe.Stream
+		want   StreamInfo
+	}{
+		{
+			name: "hdr video",
+			stream: ffprobe.Stream{
+				Index:         0,
+				CodecName:     "hevc",
+				CodecType:     "video",
+				ColorTransfer: "smpte2084",
+				Width:         3840,
+				Height:        2160,
+				BitRate:       "40000000",
+			},
+			want: StreamInfo{
+				BitRate:       40000000,
+				Codec:         "hevc",
+				ColorTransfer: "smpte2084",
+				HDR:           true,
+				Height:        2160,
+				Type:          "video",
+				Width:         3840,
+			},
+		},
+		{
+			name: "audio with mkvmerge statistics",
+			stream: ffprobe.Stream{
+				Index:     1,
+				CodecName: "ac3",
+				CodecType: "audio",
+				Channels:  6,
+				Tags:      map[string]string{"language": "eng", "BPS": "640000"},
+			},
+			want: StreamInfo{
+				BitRate:  640000,
+				Channels: 6,
+				Codec:    "ac3",
+				Index:    1,
+				Language: "eng",
+				Type:     "audio",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newStreamInfo(tt.stream); got != tt.want {
+				t.Errorf("newStreamInfo() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
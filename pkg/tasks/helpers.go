@@ -0,0 +1,38 @@
+package tasks
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// removeFiles is used to clean up partial output from a failed or cancelled task.  Files that were never created are
+// expected, so errors are ignored.
+func removeFiles(filenames []string) {
+	for _, filename := range filenames {
+		os.Remove(filename)
+	}
+}
+
+// sameFile checks if two paths refer to the same file name
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
+
+// lowPriorityCommand returns a command that's killed when ctx is done, run through nice when lowPriority is set and
+// nice is available
+func lowPriorityCommand(ctx context.Context, lowPriority bool, name string, args ...string) *exec.Cmd {
+	if lowPriority {
+		if nice, err := exec.LookPath("nice"); err == nil {
+			args = append([]string{name}, args...)
+			name = nice
+		}
+	}
+	return exec.CommandContext(ctx, name, args...)
+}
@@ -0,0 +1,111 @@
+package tasks
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TranscodeProgress is a progress report from ffmpeg while a file is transcoded
+type TranscodeProgress struct {
+	Frame        int           // Frames encoded so far
+	TotalFrames  int           // Frames in the input, or 0 if it wasn't analyzed
+	FPS          float64       // Frames encoded per second
+	Speed        float64       // Encoding speed as a multiple of the playback speed, or 0 if it isn't known yet
+	OutTime      time.Duration // Length of the video encoded so far
+	BytesWritten int64         // Size of the output so far
+	Done         bool          // Set on the last report, once ffmpeg has finished
+}
+
+// Fraction returns how much of the file has been encoded, from 0 to 1, or -1 if it isn't known
+func (p TranscodeProgress) Fraction() float64 {
+	if p.TotalFrames <= 0 {
+		return -1
+	}
+	return min(1, float64(p.Frame)/float64(p.TotalFrames))
+}
+
+// ETA returns how long encoding the rest of the file should take, or 0 if it isn't known
+func (p TranscodeProgress) ETA() time.Duration {
+	if p.TotalFrames <= 0 || p.FPS <= 0 || p.Frame >= p.TotalFrames {
+		return 0
+	}
+	return time.Duration(float64(p.TotalFrames-p.Frame) / p.FPS * float64(time.Second))
+}
+
+// progressListener receives the reports ffmpeg writes with "-progress", over a local TCP connection
+type progressListener struct {
+	listener net.Listener
+}
+
+func listenProgress() (*progressListener, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return &progressListener{listener: listener}, nil
+}
+
+// URL returns the address to give ffmpeg with "-progress"
+func (l *progressListener) URL() string {
+	return "tcp://" + l.listener.Addr().String()
+}
+
+// Run waits for ffmpeg to connect, and calls report with every progress report until ffmpeg exits.  It returns early
+// if the listener is closed before ffmpeg connects.
+func (l *progressListener) Run(totalFrames int, report func(progress TranscodeProgress)) {
+	conn, err := l.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	readProgress(conn, totalFrames, report)
+}
+
+func (l *progressListener) Close() error {
+	return l.listener.Close()
+}
+
+// readProgress parses ffmpeg progress output, which is blocks of key=value lines that each end with a "progress" key
+func readProgress(r io.Reader, totalFrames int, report func(progress TranscodeProgress)) {
+	progress := TranscodeProgress{TotalFrames: totalFrames}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+
+		// Values that ffmpeg doesn't know yet are reported as N/A, which leave the previous value in place
+		switch key {
+		case "frame":
+			if frame, err := strconv.Atoi(value); err == nil {
+				progress.Frame = frame
+			}
+		case "fps":
+			if fps, err := strconv.ParseFloat(value, 64); err == nil {
+				progress.FPS = fps
+			}
+		case "speed":
+			if speed, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+				progress.Speed = speed
+			}
+		case "out_time_us":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+				progress.OutTime = time.Duration(us) * time.Microsecond
+			}
+		case "total_size":
+			if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+				progress.BytesWritten = size
+			}
+		case "progress":
+			progress.Done = value == "end"
+			report(progress)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package tasks
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_readProgress(t *testing.T) {
+	output := `frame=0
+fps=0.00
+total_size=N/A
+out_time_us=N/A
+speed=N/A
+progress=continue
+frame=480
+fps=48.00
+stream_0_0_q=28.0
+total_size=1048576
+out_time_us=20000000
+out_time=00:00:20.000000
+speed=2.00x
+progress=continue
+frame=1440
+fps=48.00
+total_size=3145728
+out_time_us=60000000
+speed=2.00x
+progress=end
+`
+
+	var got []TranscodeProgress
+	readProgress(strings.NewReader(output), 1440, func(progress TranscodeProgress) {
+		got = append(got, progress)
+	})
+
+	want := []TranscodeProgress{
+		{TotalFrames: 1440},
+		{Frame: 480, TotalFrames: 1440, FPS: 48, Speed: 2, OutTime: 20 * time.Second, BytesWritten: 1 << 20},
+		{Frame: 1440, TotalFrames: 1440, FPS: 48, Speed: 2, OutTime: time.Minute, BytesWritten: 3 << 20, Done: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("readProgress() got %d reports, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("readProgress() report %d got = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if eta := got[1].ETA(); eta != 20*time.Second {
+		t.Errorf("ETA() got = %v, want %v", eta, 20*time.Second)
+	}
+	if fraction := got[1].Fraction(); fraction != 1.0/3 {
+		t.Errorf("Fraction() got = %v, want %v", fraction, 1.0/3)
+	}
+	if fraction := (TranscodeProgress{Frame: 10}).Fraction(); fraction != -1 {
+		t.Errorf("Fraction() without a frame count got = %v, want -1", fraction)
+	}
+}
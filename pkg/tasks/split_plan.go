@@ -0,0 +1,183 @@
+package tasks
+
+import (
+	"fmt"
+	mediakit "github.com/neptune-media/MediaKit-go"
+	"gopkg.in/yaml.v3"
+	"os"
+	"sort"
+	"time"
+)
+
+// SplitPlan describes how an input file is split into episodes
+type SplitPlan struct {
+	Input    string             `json:"input" yaml:"input"`
+	Episodes []SplitPlanEpisode `json:"episodes" yaml:"episodes"`
+}
+
+// SplitPlanEpisode describes a single episode as a range of chapters from the input file
+type SplitPlanEpisode struct {
+	FirstChapter int    `json:"first_chapter" yaml:"first_chapter"` // Number of the first chapter in the episode, starting at 1
+	LastChapter  int    `json:"last_chapter" yaml:"last_chapter"`   // Number of the last chapter in the episode, inclusive
+	Start        string `json:"start" yaml:"start"`                 // Informational, start time of the first chapter
+	End          string `json:"end" yaml:"end"`                     // Informational, end time of the last chapter
+
+	Length time.Duration `json:"-" yaml:"-"` // Length of the episode, only known for plans built from the input file
+}
+
+// newSplitPlan describes episodes as ranges of chapters, numbered by their position in chapters, which holds every
+// chapter of the input file
+func newSplitPlan(inputFilename string, episodes []*mediakit.Episode, chapters []*mediakit.Chapter) *SplitPlan {
+	plan := &SplitPlan{
+		Input:    inputFilename,
+		Episodes: make([]SplitPlanEpisode, 0, len(episodes)),
+	}
+
+	for _, episode := range episodes {
+		if len(episode.Chapters) == 0 {
+			continue
+		}
+
+		first := episode.Chapters[0]
+		last := episode.Chapters[len(episode.Chapters)-1]
+		plan.Episodes = append(plan.Episodes, SplitPlanEpisode{
+			FirstChapter: chapterNumber(chapters, first),
+			LastChapter:  chapterNumber(chapters, last),
+			Start:        formatTimestamp(first.Start),
+			End:          formatTimestamp(last.End),
+			Length:       episodeLength(episode),
+		})
+	}
+
+	return plan
+}
+
+// chapterNumber returns the number of the chapter in chapters that starts closest to chapter, starting at 1.  Episode
+// detection may move chapter starts to the nearest I-frame, so they don't always match exactly.
+func chapterNumber(chapters []*mediakit.Chapter, chapter *mediakit.Chapter) int {
+	closest := 0
+	for i, c := range chapters {
+		if (c.Start - chapter.Start).Abs() < (chapters[closest].Start - chapter.Start).Abs() {
+			closest = i
+		}
+	}
+	return closest + 1
+}
+
+// formatTimestamp formats d as hh:mm:ss.mmm
+func formatTimestamp(d time.Duration) string {
+	hours := d / time.Hour
+	minutes := (d % time.Hour) / time.Minute
+	seconds := (d % time.Minute) / time.Second
+	millis := (d % time.Second) / time.Millisecond
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", hours, minutes, seconds, millis)
+}
+
+// ReadSplitPlans reads a list of split plans from a YAML file
+func ReadSplitPlans(path string) ([]*SplitPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plans := make([]*SplitPlan, 0)
+	if err := yaml.Unmarshal(data, &plans); err != nil {
+		return nil, err
+	}
+
+	for _, plan := range plans {
+		if err := plan.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid split plan for %s: %v", plan.Input, err)
+		}
+	}
+
+	return plans, nil
+}
+
+// WriteSplitPlans writes a list of split plans to a YAML file, which can be edited and read back with ReadSplitPlans
+func WriteSplitPlans(path string, plans []*SplitPlan) error {
+	data, err := yaml.Marshal(plans)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0640)
+}
+
+// FindSplitPlan returns the plan for inputFilename from plans, or nil if there isn't one
+func FindSplitPlan(plans []*SplitPlan, inputFilename string) *SplitPlan {
+	for _, plan := range plans {
+		if sameFile(plan.Input, inputFilename) {
+			return plan
+		}
+	}
+	return nil
+}
+
+// Validate checks that episodes are in order, and don't share chapters
+func (p *SplitPlan) Validate() error {
+	if len(p.Episodes) == 0 {
+		return fmt.Errorf("no episodes")
+	}
+
+	previous := 0
+	for i, episode := range p.Episodes {
+		if episode.FirstChapter < 1 || episode.LastChapter < episode.FirstChapter {
+			return fmt.Errorf("episode %d: invalid chapter range %d-%d", i+1, episode.FirstChapter, episode.LastChapter)
+		}
+		if episode.FirstChapter <= previous {
+			return fmt.Errorf("episode %d: starts at chapter %d, which is before the end of the previous episode",
+				i+1, episode.FirstChapter)
+		}
+		previous = episode.LastChapter
+	}
+
+	return nil
+}
+
+// apply groups chapters, which holds every chapter of the input file, into the episodes described by the plan.  Each
+// episode starts on the first of frames, the I-frame times, at or after its first chapter, which is where mkvmerge
+// can cut and where episodes found from chapters start too.  chapters is left untouched.
+func (p *SplitPlan) apply(chapters []*mediakit.Chapter, frames []time.Duration) ([]*mediakit.Episode, error) {
+	frames = append([]time.Duration(nil), frames...)
+	sort.Slice(frames, func(i, j int) bool { return frames[i] < frames[j] })
+
+	results := make([]*mediakit.Episode, 0, len(p.Episodes))
+	for i, episode := range p.Episodes {
+		if episode.LastChapter > len(chapters) {
+			return nil, fmt.Errorf("episode %d: ends at chapter %d, but the input only has %d chapters",
+				i+1, episode.LastChapter, len(chapters))
+		}
+
+		planned := make([]*mediakit.Chapter, 0, episode.LastChapter-episode.FirstChapter+1)
+		for _, chapter := range chapters[episode.FirstChapter-1 : episode.LastChapter] {
+			copied := *chapter
+			planned = append(planned, &copied)
+		}
+
+		first := planned[0]
+		if start, ok := nextFrame(frames, first.Start); ok && start < first.End {
+			// The previous episode runs up to the new start, if it ended where this one began
+			if len(results) > 0 {
+				previous := results[len(results)-1].Chapters
+				if last := previous[len(previous)-1]; last.End == first.Start {
+					last.End = start
+				}
+			}
+			first.Start = start
+		}
+
+		results = append(results, &mediakit.Episode{Chapters: planned})
+	}
+
+	return results, nil
+}
+
+// nextFrame returns the first of frames, which must be sorted, at or after t
+func nextFrame(frames []time.Duration, t time.Duration) (time.Duration, bool) {
+	i := sort.Search(len(frames), func(i int) bool { return frames[i] >= t })
+	if i == len(frames) {
+		return 0, false
+	}
+	return frames[i], true
+}
@@ -0,0 +1,145 @@
+package tasks
+
+import (
+	mediakit "github.com/neptune-media/MediaKit-go"
+	"testing"
+	"time"
+)
+
+// newTestChapters returns consecutive chapters of the given lengths, starting at 0
+func newTestChapters(lengths ...time.Duration) []*mediakit.Chapter {
+	chapters := make([]*mediakit.Chapter, 0, len(lengths))
+	start := time.Duration(0)
+	for _, length := range lengths {
+		chapters = append(chapters, &mediakit.Chapter{Start: start, End: start + length})
+		start += length
+	}
+	return chapters
+}
+
+func Test_newSplitPlan(t *testing.T) {
+	chapters := newTestChapters(10*time.Minute, 12*time.Minute, time.Minute, 2*time.Minute, 11*time.Minute,
+		11*time.Minute+500*time.Millisecond)
+
+	// Episode detection left out the fourth chapter, and moved the start of the fifth to an I-frame
+	snapped := &mediakit.Chapter{Start: chapters[4].Start + 400*time.Millisecond, End: chapters[4].End}
+	episodes := []*mediakit.Episode{
+		{Chapters: chapters[0:3]},
+		{Chapters: []*mediakit.Chapter{snapped, chapters[5]}},
+	}
+
+	plan := newSplitPlan("input.mkv", episodes, chapters)
+	want := []SplitPlanEpisode{
+		{FirstChapter: 1, LastChapter: 3, Start: "00:00:00.000", End: "00:23:00.000", Length: 23 * time.Minute},
+		{FirstChapter: 5, LastChapter: 6, Start: "00:25:00.400", End: "00:47:00.500", Length: 22*time.Minute + 100*time.Millisecond},
+	}
+
+	if len(plan.Episodes) != len(want) {
+		t.Fatalf("newSplitPlan() got %d episodes, want %d", len(plan.Episodes), len(want))
+	}
+	for i := range want {
+		if plan.Episodes[i] != want[i] {
+			t.Errorf("newSplitPlan() episode %d got = %+v, want %+v", i+1, plan.Episodes[i], want[i])
+		}
+	}
+}
+
+func TestSplitPlan_apply(t *testing.T) {
+	chapters := newTestChapters(time.Minute, time.Minute, time.Minute, time.Minute, time.Minute)
+
+	tests := []struct {
+		name     string
+		plan     SplitPlan
+		want     []int // Number of chapters in each resulting episode
+		wantErr  bool
+		validErr bool
+	}{
+		{
+			name: "move boundary",
+			plan: SplitPlan{Episodes: []SplitPlanEpisode{
+				{FirstChapter: 1, LastChapter: 2},
+				{FirstChapter: 3, LastChapter: 5},
+			}},
+			want: []int{2, 3},
+		},
+		{
+			name: "drop a chapter",
+			plan: SplitPlan{Episodes: []SplitPlanEpisode{
+				{FirstChapter: 2, LastChapter: 5},
+			}},
+			want: []int{4},
+		},
+		{
+			name: "too many chapters",
+			plan: SplitPlan{Episodes: []SplitPlanEpisode{
+				{FirstChapter: 1, LastChapter: 6},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "overlapping episodes",
+			plan: SplitPlan{Episodes: []SplitPlanEpisode{
+				{FirstChapter: 1, LastChapter: 3},
+				{FirstChapter: 3, LastChapter: 5},
+			}},
+			validErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.plan.Validate(); (err != nil) != tt.validErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.validErr)
+			}
+			if tt.validErr {
+				return
+			}
+
+			got, err := tt.plan.apply(chapters, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("apply() got %d episodes, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if len(got[i].Chapters) != tt.want[i] {
+					t.Errorf("apply() episode %d got %d chapters, want %d", i+1, len(got[i].Chapters), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSplitPlan_apply_frames(t *testing.T) {
+	chapters := newTestChapters(time.Minute, time.Minute, time.Minute, time.Minute, time.Minute)
+	frames := []time.Duration{3*time.Minute + 10*time.Second, 0, 59500 * time.Millisecond, 2*time.Minute + 400*time.Millisecond}
+
+	// Episodes found from chapters start on the first I-frame of their first chapter
+	found := []*mediakit.Episode{
+		{Chapters: []*mediakit.Chapter{chapters[0], {Start: chapters[1].Start, End: 2*time.Minute + 400*time.Millisecond}}},
+		{Chapters: []*mediakit.Chapter{{Start: 2*time.Minute + 400*time.Millisecond, End: chapters[2].End}, chapters[3], chapters[4]}},
+	}
+
+	// Applying the plan written for them cuts in the same places
+	got, err := newSplitPlan("input.mkv", found, chapters).apply(chapters, frames)
+	if err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+	if len(got) != len(found) {
+		t.Fatalf("apply() got %d episodes, want %d", len(got), len(found))
+	}
+	for i := range found {
+		if len(got[i].Chapters) != len(found[i].Chapters) {
+			t.Fatalf("apply() episode %d got %d chapters, want %d", i+1, len(got[i].Chapters), len(found[i].Chapters))
+		}
+		for j := range found[i].Chapters {
+			if *got[i].Chapters[j] != *found[i].Chapters[j] {
+				t.Errorf("apply() episode %d chapter %d got = %+v, want %+v", i+1, j+1, *got[i].Chapters[j], *found[i].Chapters[j])
+			}
+		}
+	}
+
+	if chapters[1].End != 2*time.Minute || chapters[2].Start != 2*time.Minute {
+		t.Errorf("apply() changed the chapters it was given")
+	}
+}
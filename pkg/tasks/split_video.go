@@ -1,30 +1,41 @@
 package tasks
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	mediakit "github.com/neptune-media/MediaKit-go"
 	mediatasks "github.com/neptune-media/MediaKit-go/tasks"
-	"github.com/neptune-media/MediaKit-go/tools/ffprobe"
 	"github.com/neptune-media/MediaKit-go/tools/mkvmerge"
 	"github.com/neptune-media/MediaKit-go/tools/mkvpropedit"
 	"go.uber.org/zap"
 	"log"
 	"path/filepath"
+	"strconv"
 	"time"
 )
 
 type SplitVideo struct {
 	Logger           *zap.SugaredLogger
 	Options          SplitVideoOptions
+	SplitPlan        *SplitPlan // Overrides the episode boundaries found from chapters, when set
 	UseLowerPriority bool
 	WorkDir          string
 }
 
 type SplitVideoOptions struct {
-	EndingChapterTime    int
-	MinimumChapters      int
-	MinimumEpisodeLength int
+	EndingChapterTime    int  // Maximum length of the chapter that ends an episode, in seconds
+	IgnoreMissingEnd     bool // Allows the last episode to end without an ending chapter
+	MaximumEpisodeLength int  // Episodes longer than this many minutes are treated as an error, 0 disables the check
+	MinimumChapters      int  // Minimum number of chapters in an episode
+	MinimumEpisodeLength int  // Minimum length of an episode, in minutes
+}
+
+// SplitEpisode is a file produced by splitting, along with the length of the episode it holds
+type SplitEpisode struct {
+	Filename string
+	Length   time.Duration
 }
 
 var defaultEpisodeBuilderOptions = mediakit.EpisodeBuilderOptions{
@@ -34,6 +45,45 @@ var defaultEpisodeBuilderOptions = mediakit.EpisodeBuilderOptions{
 	MinimumEpisodeLength: 20 * time.Minute,
 }
 
+// Validate checks that the options make sense together, so mistakes are caught before any probing starts
+func (o SplitVideoOptions) Validate() error {
+	if o.EndingChapterTime < 0 {
+		return fmt.Errorf("ending chapter time must not be negative")
+	}
+	if o.MaximumEpisodeLength < 0 {
+		return fmt.Errorf("maximum episode length must not be negative")
+	}
+	if o.MinimumChapters < 0 {
+		return fmt.Errorf("minimum chapters must not be negative")
+	}
+	if o.MinimumEpisodeLength < 0 {
+		return fmt.Errorf("minimum episode length must not be negative")
+	}
+
+	// Zero values are replaced by defaults, so compare against what will actually be used
+	endingChapterTime := time.Duration(o.EndingChapterTime) * time.Second
+	if endingChapterTime == 0 {
+		endingChapterTime = defaultEpisodeBuilderOptions.EndingChapterTime
+	}
+	minimumEpisodeLength := time.Duration(o.MinimumEpisodeLength) * time.Minute
+	if minimumEpisodeLength == 0 {
+		minimumEpisodeLength = defaultEpisodeBuilderOptions.MinimumEpisodeLength
+	}
+
+	if endingChapterTime >= minimumEpisodeLength {
+		return fmt.Errorf("ending chapter time (%s) must be shorter than the minimum episode length (%s)",
+			endingChapterTime, minimumEpisodeLength)
+	}
+
+	maximumEpisodeLength := time.Duration(o.MaximumEpisodeLength) * time.Minute
+	if maximumEpisodeLength > 0 && maximumEpisodeLength < minimumEpisodeLength {
+		return fmt.Errorf("maximum episode length (%s) must not be shorter than the minimum episode length (%s)",
+			maximumEpisodeLength, minimumEpisodeLength)
+	}
+
+	return nil
+}
+
 // Helper null sink for matroska logs
 type sink int
 
@@ -42,27 +92,26 @@ func (s sink) Write(p []byte) (int, error) {
 }
 
 func (t *SplitVideo) Do(ctx context.Context, inputFilename string) ([]string, error) {
-	logger := t.Logger
-	outputFilename := filepath.Join(t.WorkDir, "episode.mkv")
-
-	// matroska-go outputs every block and is super noisy
-	log.SetOutput(new(sink))
-
-	// Read video I-frames
-	logger.Infow("using input file", "filename", inputFilename)
-	logger.Infow("reading i-frames")
-	probe := &ffprobe.FFProbe{Filename: inputFilename, GetFrames: true, LowPriority: t.UseLowerPriority}
-	frames, err := mediatasks.ReadVideoIFrames(probe)
+	episodes, err := t.DoEpisodes(ctx, inputFilename)
 	if err != nil {
 		return nil, err
 	}
 
-	// Use I-frames to calculate episode cutpoints
-	opts := t.getEpisodeBuilderOptions(frames)
-	logger.Infow("reading video episodes")
-	episodes, err := mediatasks.ReadVideoEpisodes(inputFilename, *opts)
+	filenames := make([]string, len(episodes))
+	for i, episode := range episodes {
+		filenames[i] = episode.Filename
+	}
+	return filenames, nil
+}
+
+// DoEpisodes splits the input file like Do, and also returns the length of every episode
+func (t *SplitVideo) DoEpisodes(ctx context.Context, inputFilename string) ([]SplitEpisode, error) {
+	logger := t.Logger
+	outputFilename := t.getOutputFilename()
+
+	episodes, err := t.readEpisodes(ctx, inputFilename)
 	if err != nil {
-		return nil, fmt.Errorf("error while reading episodes: %v", err)
+		return nil, err
 	}
 
 	// Split video
@@ -74,23 +123,217 @@ func (t *SplitVideo) Do(ctx context.Context, inputFilename string) ([]string, er
 	)
 	runner.LowPriority = t.UseLowerPriority
 
-	err = runner.Do()
+	filenames := t.GetOutputFilenames(len(episodes))
+	err = runner.DoWithContext(ctx)
 	if err != nil {
+		removeFiles(filenames)
 		return nil, fmt.Errorf("error while splitting file: %v\noutput from command:\n%s\n%s", err, runner.GetStdout(), runner.GetStderr())
 	}
 
 	logger.Infow("fixing episode chapter names")
 	err = mkvpropedit.FixEpisodeChapterNames(episodes, outputFilename)
 	if err != nil {
+		removeFiles(filenames)
 		return nil, fmt.Errorf("error while writing chapters: %v", err)
 	}
 
-	filenames := make([]string, len(episodes))
-	for i := range episodes {
+	results := make([]SplitEpisode, len(episodes))
+	for i, episode := range episodes {
+		results[i] = SplitEpisode{Filename: filenames[i], Length: episodeLength(episode)}
+	}
+	return results, nil
+}
+
+// Plan finds the episodes in the input file, without splitting it
+func (t *SplitVideo) Plan(ctx context.Context, inputFilename string) (*SplitPlan, error) {
+	episodes, err := t.readEpisodes(ctx, inputFilename)
+	if err != nil {
+		return nil, err
+	}
+	chapters, err := t.readChapters(ctx, inputFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSplitPlan(inputFilename, episodes, chapters), nil
+}
+
+// GetOutputFilenames returns the names of the files that splitting into numEpisodes episodes would produce
+func (t *SplitVideo) GetOutputFilenames(numEpisodes int) []string {
+	outputFilename := t.getOutputFilename()
+	filenames := make([]string, numEpisodes)
+	for i := range filenames {
 		filenames[i] = mkvmerge.FormatSplitOutputName(outputFilename, i)
 	}
+	return filenames
+}
 
-	return filenames, nil
+func (t *SplitVideo) getOutputFilename() string {
+	return filepath.Join(t.WorkDir, "episode.mkv")
+}
+
+// readEpisodes uses the chapters and I-frames of the input file to find where each episode starts and ends, or the
+// split plan when there is one
+func (t *SplitVideo) readEpisodes(ctx context.Context, inputFilename string) ([]*mediakit.Episode, error) {
+	logger := t.Logger
+	logger.Infow("using input file", "filename", inputFilename)
+
+	// Read video I-frames, which split plans are cut on too
+	logger.Infow("reading i-frames")
+	frames, err := t.readIFrames(ctx, inputFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.SplitPlan != nil {
+		chapters, err := t.readChapters(ctx, inputFilename)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Infow("using episodes from split plan", "episodes", len(t.SplitPlan.Episodes))
+		episodes, err := t.SplitPlan.apply(chapters, frames)
+		if err != nil {
+			return nil, fmt.Errorf("error while applying split plan: %v", err)
+		}
+		return episodes, nil
+	}
+
+	// matroska-go outputs every block and is super noisy
+	log.SetOutput(new(sink))
+
+	// Use I-frames to calculate episode cutpoints
+	opts := t.getEpisodeBuilderOptions(frames)
+	logger.Infow("reading video episodes")
+	episodes, err := mediatasks.ReadVideoEpisodes(inputFilename, *opts)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading episodes: %v", err)
+	}
+	if err := t.checkMaximumEpisodeLength(episodes); err != nil {
+		return nil, err
+	}
+
+	return episodes, nil
+}
+
+// readChapters returns every chapter of filename, in order.  Split plans number chapters from this list, since
+// episode detection leaves out chapters that don't belong to an episode.
+func (t *SplitVideo) readChapters(ctx context.Context, filename string) ([]*mediakit.Chapter, error) {
+	output, err := t.probe(ctx, "-v", "error", "-show_chapters", "-of", "json", filename)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading chapters: %v", err)
+	}
+
+	return parseChapters(output)
+}
+
+// readIFrames returns the time of every I-frame in the first video stream of filename.  Times are kept on the timeline
+// ffprobe reports, which chapter times are on too, even when the stream doesn't start at 0.
+func (t *SplitVideo) readIFrames(ctx context.Context, filename string) ([]time.Duration, error) {
+	output, err := t.probe(ctx, "-v", "error", "-select_streams", "v:0", "-skip_frame", "nokey", "-show_entries",
+		"frame=pts_time", "-of", "json", filename)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading i-frames: %v", err)
+	}
+
+	return parseIFrames(output)
+}
+
+// probe runs ffprobe with args, at a lower priority when UseLowerPriority is set, and returns its output.  ffprobe is
+// run directly so it can be killed when ctx is cancelled, since reading frames takes minutes for a whole disc.
+func (t *SplitVideo) probe(ctx context.Context, args ...string) ([]byte, error) {
+	stderr := &bytes.Buffer{}
+	cmd := lowPriorityCommand(ctx, t.UseLowerPriority, "ffprobe", args...)
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("%v: %s", err, firstLines(stderr.String(), 5))
+	}
+	return output, nil
+}
+
+// parseChapters reads the chapters from ffprobe's json output
+func parseChapters(output []byte) ([]*mediakit.Chapter, error) {
+	var probe struct {
+		Chapters []struct {
+			StartTime string            `json:"start_time"`
+			EndTime   string            `json:"end_time"`
+			Tags      map[string]string `json:"tags"`
+		} `json:"chapters"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("error while reading chapters: %v", err)
+	}
+
+	chapters := make([]*mediakit.Chapter, 0, len(probe.Chapters))
+	for i, chapter := range probe.Chapters {
+		start, err := strconv.ParseFloat(chapter.StartTime, 64)
+		if err != nil {
+			return nil, fmt.Errorf("chapter %d: invalid start time %q", i+1, chapter.StartTime)
+		}
+		end, err := strconv.ParseFloat(chapter.EndTime, 64)
+		if err != nil {
+			return nil, fmt.Errorf("chapter %d: invalid end time %q", i+1, chapter.EndTime)
+		}
+		chapters = append(chapters, &mediakit.Chapter{
+			Start: time.Duration(start * float64(time.Second)),
+			End:   time.Duration(end * float64(time.Second)),
+			Name:  chapter.Tags["title"],
+		})
+	}
+	return chapters, nil
+}
+
+// parseIFrames reads the frame times from ffprobe's json output
+func parseIFrames(output []byte) ([]time.Duration, error) {
+	var probe struct {
+		Frames []struct {
+			PTSTime string `json:"pts_time"`
+		} `json:"frames"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("error while reading i-frames: %v", err)
+	}
+
+	frames := make([]time.Duration, 0, len(probe.Frames))
+	for _, frame := range probe.Frames {
+		// Frames without a timestamp can't be used as cut points
+		seconds, err := strconv.ParseFloat(frame.PTSTime, 64)
+		if err != nil {
+			continue
+		}
+		frames = append(frames, time.Duration(seconds*float64(time.Second)))
+	}
+	return frames, nil
+}
+
+// checkMaximumEpisodeLength catches episodes that are too long, which usually means an episode boundary was missed
+func (t *SplitVideo) checkMaximumEpisodeLength(episodes []*mediakit.Episode) error {
+	maximum := time.Duration(t.Options.MaximumEpisodeLength) * time.Minute
+	if maximum == 0 {
+		return nil
+	}
+
+	for i, episode := range episodes {
+		length := episodeLength(episode)
+		if length > maximum {
+			return fmt.Errorf("episode %d is %s long, which is longer than the maximum of %s (use a split plan to fix the episode boundaries)",
+				i+1, length.Round(time.Second), maximum)
+		}
+	}
+
+	return nil
+}
+
+// episodeLength returns the time from the start of the first chapter of episode to the end of the last one
+func episodeLength(episode *mediakit.Episode) time.Duration {
+	if len(episode.Chapters) == 0 {
+		return 0
+	}
+	return episode.Chapters[len(episode.Chapters)-1].End - episode.Chapters[0].Start
 }
 
 func (t *SplitVideo) getEpisodeBuilderOptions(frames []time.Duration) *mediakit.EpisodeBuilderOptions {
@@ -99,6 +342,7 @@ func (t *SplitVideo) getEpisodeBuilderOptions(frames []time.Duration) *mediakit.
 		FrameSeeker: &mediakit.FrameSeeker{Frames: frames},
 
 		EndingChapterTime:    time.Duration(taskOpts.EndingChapterTime) * time.Second,
+		IgnoreMissingEnd:     taskOpts.IgnoreMissingEnd,
 		MinimumChapters:      taskOpts.MinimumChapters,
 		MinimumEpisodeLength: time.Duration(taskOpts.MinimumEpisodeLength) * time.Minute,
 	}
@@ -0,0 +1,184 @@
+package tasks
+
+import (
+	"context"
+	mediakit "github.com/neptune-media/MediaKit-go"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitVideoOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    SplitVideoOptions
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			opts: SplitVideoOptions{},
+		},
+		{
+			name: "all set",
+			opts: SplitVideoOptions{
+				EndingChapterTime:    90,
+				MaximumEpisodeLength: 50,
+				MinimumChapters:      3,
+				MinimumEpisodeLength: 40,
+			},
+		},
+		{
+			name:    "negative chapters",
+			opts:    SplitVideoOptions{MinimumChapters: -1},
+			wantErr: true,
+		},
+		{
+			name:    "ending chapter longer than default episode",
+			opts:    SplitVideoOptions{EndingChapterTime: 25 * 60},
+			wantErr: true,
+		},
+		{
+			name:    "maximum shorter than minimum",
+			opts:    SplitVideoOptions{MaximumEpisodeLength: 10, MinimumEpisodeLength: 20},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseIFrames(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string // As written by ffprobe -show_entries frame=pts_time -of json
+		want    []time.Duration
+		wantErr bool
+	}{
+		{
+			name: "starts at zero",
+			output: `{
+    "frames": [
+        {
+            "pts_time": "0.000000"
+        },
+        {
+            "pts_time": "2.502000"
+        },
+        {
+            "pts_time": "5.005000"
+        }
+    ]
+}`,
+			want: []time.Duration{0, 2502 * time.Millisecond, 5005 * time.Millisecond},
+		},
+		{
+			// Timestamps stay on the timeline ffprobe reports, which is the one chapter times are on too
+			name: "non-zero start time",
+			output: `{
+    "frames": [
+        {
+            "pts_time": "1.400000"
+        },
+        {
+            "pts_time": "3.902000"
+        }
+    ]
+}`,
+			want: []time.Duration{1400 * time.Millisecond, 3902 * time.Millisecond},
+		},
+		{
+			name: "frames without a timestamp",
+			output: `{
+    "frames": [
+        {
+            "pts_time": "N/A"
+        },
+        {
+            "pts_time": "0.041000"
+        },
+        {
+        },
+        {
+            "pts_time": "N/A"
+        }
+    ]
+}`,
+			want: []time.Duration{41 * time.Millisecond},
+		},
+		{name: "no frames", output: `{"frames": []}`, want: []time.Duration{}},
+		{name: "no frames section", output: `{}`, want: []time.Duration{}},
+		{name: "not json", output: `frame|pts_time=0.000000`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIFrames([]byte(tt.output))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseIFrames() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseIFrames() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitVideo_readIFrames(t *testing.T) {
+	for _, tool := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s isn't installed", tool)
+		}
+	}
+
+	// Four seconds with a keyframe every second, starting 10s into the timeline
+	input := filepath.Join(t.TempDir(), "input.mkv")
+	cmd := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "testsrc=duration=4:size=64x48:rate=10",
+		"-c:v", "mpeg2video", "-g", "10", "-output_ts_offset", "10", input)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("ffmpeg error = %v: %s", err, output)
+	}
+
+	task := &SplitVideo{}
+	got, err := task.readIFrames(context.Background(), input)
+	if err != nil {
+		t.Fatalf("readIFrames() error = %v", err)
+	}
+	want := []time.Duration{10 * time.Second, 11 * time.Second, 12 * time.Second, 13 * time.Second}
+	if len(got) != len(want) {
+		t.Fatalf("readIFrames() got = %v, want %v", got, want)
+	}
+	for i := range want {
+		if diff := got[i] - want[i]; diff < -50*time.Millisecond || diff > 50*time.Millisecond {
+			t.Errorf("readIFrames() frame %d got = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseChapters(t *testing.T) {
+	output := `{"chapters": [
+		{"id": 1, "start_time": "0.000000", "end_time": "600.000000", "tags": {"title": "Opening"}},
+		{"id": 2, "start_time": "600.000000", "end_time": "1320.500000"}
+	]}`
+	got, err := parseChapters([]byte(output))
+	if err != nil {
+		t.Fatalf("parseChapters() error = %v", err)
+	}
+	want := []mediakit.Chapter{
+		{Start: 0, End: 10 * time.Minute, Name: "Opening"},
+		{Start: 10 * time.Minute, End: 22*time.Minute + 500*time.Millisecond},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseChapters() got %d chapters, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if *got[i] != want[i] {
+			t.Errorf("parseChapters() chapter %d got = %+v, want %+v", i+1, *got[i], want[i])
+		}
+	}
+}
@@ -19,9 +19,16 @@ const (
 	matroskaReserveIndexSpacePerHour = 50
 )
 
+const defaultOutputNameFormat = "%s-output.mkv"
+
+// progressLogInterval limits how often transcoding progress is logged
+const progressLogInterval = time.Second
+
 type TranscodeVideo struct {
 	Logger           *zap.SugaredLogger
+	OnProgress       func(progress TranscodeProgress) // Called with every progress report from ffmpeg, when set
 	Options          TranscodeVideoOptions
+	OutputNameFormat string // Format for the output filename, given the input basename.  Defaults to "%s-output.mkv"
 	UseLowerPriority bool
 	WorkDir          string
 }
@@ -61,39 +68,146 @@ func newEncodingOptionsFromTaskWithFallback(opts map[string]interface{}, fallbac
 
 func (t *TranscodeVideo) Do(ctx context.Context, inputFilename string, analyzeResults *AnalyzeResults) (string, error) {
 	logger := t.Logger
-	basename := strings.TrimSuffix(filepath.Base(inputFilename), filepath.Ext(inputFilename))
-	outputFilename := filepath.Join(t.WorkDir, fmt.Sprintf("%s-output.mkv", basename))
-
-	opts := t.Options
-	audioOpts, _ := newEncodingOptionsFromTaskWithFallback(opts.AudioEncodingOptions, &ffmpeg.GenericAudioOptions{})
-	containerOpts, _ := newEncodingOptionsFromTask(opts.ContainerOptions)
-	subtitleOpts, _ := newEncodingOptionsFromTask(opts.SubtitleEncodingOptions)
-	videoOpts, _ := newEncodingOptionsFromTask(opts.VideoEncodingOptions)
 
-	// Configure some container options from helper flags
-	if err := t.configureContainerOptsFromFlags(containerOpts, analyzeResults); err != nil {
+	runner, err := t.newRunner(inputFilename, analyzeResults)
+	if err != nil {
 		return "", err
 	}
+	outputFilename := runner.OutputFilename
 
 	// Setup progress listener
-	listener := new(ffmpeg.ProgressListener)
-	listener.ReportInterval = time.Second
+	totalFrames := 0
 	if analyzeResults != nil {
-		listener.TotalFrameCount = analyzeResults.TotalFrames
+		totalFrames = analyzeResults.TotalFrames
 	}
 
-	addr, err := listener.Begin()
+	listener, err := listenProgress()
 	if err != nil {
 		logger.Errorw("error while starting codec progress listener", "err", err)
 		return "", err
 	}
-	defer listener.Close()
+	runner.InputArgs = append(runner.InputArgs, "-progress", listener.URL())
+
+	listenerDone := make(chan struct{})
+	go func() {
+		defer close(listenerDone)
+		listener.Run(totalFrames, t.newProgressReporter(logger))
+	}()
+	defer func() {
+		// Every report is delivered before Do returns
+		listener.Close()
+		<-listenerDone
+	}()
 
-	runner := &ffmpeg.FFmpeg{
+	logger.Infow("running ffmpeg",
+		"command", runner.GetCommand(),
+		"args", strings.Join(runner.GetCommandArgs(), " "))
+
+	err = runner.DoWithContext(ctx)
+	if err != nil {
+		logger.Errorw("ffmpeg failed", "stdout", runner.GetStdout(), "stderr", runner.GetStderr())
+
+		// Don't leave a partially written file behind
+		removeFiles([]string{outputFilename})
+	}
+
+	return outputFilename, err
+}
+
+// newProgressReporter returns a function that logs progress reports now and then, and passes every one of them to
+// OnProgress
+func (t *TranscodeVideo) newProgressReporter(logger *zap.SugaredLogger) func(progress TranscodeProgress) {
+	var lastLogged time.Time
+	return func(progress TranscodeProgress) {
+		if t.OnProgress != nil {
+			t.OnProgress(progress)
+		}
+
+		if time.Since(lastLogged) < progressLogInterval && !progress.Done {
+			return
+		}
+		lastLogged = time.Now()
+		logger.Infow("transcode progress",
+			"frame", progress.Frame,
+			"total frames", progress.TotalFrames,
+			"fps", progress.FPS,
+			"speed", progress.Speed,
+			"eta", progress.ETA().Round(time.Second).String())
+	}
+}
+
+// Plan returns the ffmpeg command, its arguments, and the output filename that Do would use, without running anything
+func (t *TranscodeVideo) Plan(inputFilename string, analyzeResults *AnalyzeResults) (string, []string, string, error) {
+	runner, err := t.newRunner(inputFilename, analyzeResults)
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	return runner.GetCommand(), runner.GetCommandArgs(), runner.OutputFilename, nil
+}
+
+// ValidateOutputNameFormat checks that format is usable as OutputNameFormat, which needs exactly one %s for the input
+// basename and no other verbs
+func ValidateOutputNameFormat(format string) error {
+	names := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		if i+1 == len(format) {
+			return fmt.Errorf("output name format %q ends with a lone %%", format)
+		}
+		i++
+		switch format[i] {
+		case '%':
+		case 's':
+			names++
+		default:
+			return fmt.Errorf("output name format %q can only use %%s and %%%%, not %%%c", format, format[i])
+		}
+	}
+	if names != 1 {
+		return fmt.Errorf("output name format %q must contain exactly one %%s, found %d", format, names)
+	}
+	return nil
+}
+
+// GetOutputFilename returns the name of the file that transcoding inputFilename produces
+func (t *TranscodeVideo) GetOutputFilename(inputFilename string) string {
+	nameFormat := t.OutputNameFormat
+	if nameFormat == "" {
+		nameFormat = defaultOutputNameFormat
+	}
+
+	basename := strings.TrimSuffix(filepath.Base(inputFilename), filepath.Ext(inputFilename))
+	return filepath.Join(t.WorkDir, fmt.Sprintf(nameFormat, basename))
+}
+
+// newRunner builds the ffmpeg runner for inputFilename from the task options
+func (t *TranscodeVideo) newRunner(inputFilename string, analyzeResults *AnalyzeResults) (*ffmpeg.FFmpeg, error) {
+	outputFilename := t.GetOutputFilename(inputFilename)
+
+	// Make sure the output can't replace the input while it's being read
+	if sameFile(inputFilename, outputFilename) {
+		return nil, fmt.Errorf("output file %s would overwrite the input", outputFilename)
+	}
+
+	opts := t.Options
+	audioOpts, _ := newEncodingOptionsFromTaskWithFallback(opts.AudioEncodingOptions, &ffmpeg.GenericAudioOptions{})
+	containerOpts, _ := newEncodingOptionsFromTask(opts.ContainerOptions)
+	subtitleOpts, _ := newEncodingOptionsFromTask(opts.SubtitleEncodingOptions)
+	videoOpts, _ := newEncodingOptionsFromTask(opts.VideoEncodingOptions)
+
+	// Configure some container options from helper flags
+	if err := t.configureContainerOptsFromFlags(containerOpts, analyzeResults); err != nil {
+		return nil, err
+	}
+
+	return &ffmpeg.FFmpeg{
 		AudioLanguages:        opts.AudioLanguages,
 		AudioOptions:          audioOpts,
 		ContainerOptions:      containerOpts,
-		InputArgs:             append(opts.InputArgs, "-progress", addr),
+		InputArgs:             append([]string{}, opts.InputArgs...), // Copied, since the task may be shared by workers
 		InputFilename:         inputFilename,
 		MapAllAudioStreams:    opts.CopyAllAudioStreams,
 		MapAllSubtitleStreams: opts.CopyAllSubtitleStreams,
@@ -104,19 +218,7 @@ func (t *TranscodeVideo) Do(ctx context.Context, inputFilename string, analyzeRe
 		SubtitleOptions:       subtitleOpts,
 		UseLowerPriority:      t.UseLowerPriority,
 		VideoOptions:          videoOpts,
-	}
-
-	go listener.Run(logger)
-	logger.Infow("running ffmpeg",
-		"command", runner.GetCommand(),
-		"args", strings.Join(runner.GetCommandArgs(), " "))
-
-	err = runner.DoWithContext(ctx)
-	if err != nil {
-		fmt.Printf("output? %s\n%s\n", runner.GetStdout(), runner.GetStderr())
-	}
-
-	return outputFilename, err
+	}, nil
 }
 
 // configureContainerOptsFromFlags is used to update container options from helper flags in TranscodeVideoOptions
@@ -0,0 +1,24 @@
+package tasks
+
+import "testing"
+
+func TestValidateOutputNameFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		wantErr bool
+	}{
+		{format: "%s.mkv"},
+		{format: "%s - 100%%.mkv"},
+		{format: "output.mkv", wantErr: true},
+		{format: "%s-%s.mkv", wantErr: true},
+		{format: "%s-%d.mkv", wantErr: true},
+		{format: "%s.mkv%", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if err := ValidateOutputNameFormat(tt.format); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateOutputNameFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
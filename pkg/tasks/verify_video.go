@@ -0,0 +1,168 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+const defaultDurationTolerance = 2 * time.Second
+
+// ErrVerifyFailed is reported for transcoded files that don't match what transcoding should have produced
+var ErrVerifyFailed = errors.New("output failed verification")
+
+// VerifyVideo checks a transcoded file against the analysis of its source, to catch truncated or broken outputs
+// before they reach a library
+type VerifyVideo struct {
+	DurationTolerance time.Duration // Allowed difference between the source and output durations.  Defaults to 2s
+	FullDecode        bool          // Decodes every frame of the output, which catches corruption a probe can't see
+	Logger            *zap.SugaredLogger
+	UseLowerPriority  bool
+}
+
+// Do probes outputFilename and compares it with source, the analysis of the file it was transcoded from using opts.
+// Checks that need the source analysis are skipped when source is nil.
+func (t *VerifyVideo) Do(ctx context.Context, outputFilename string, source *AnalyzeResults, opts TranscodeVideoOptions) error {
+	logger := t.Logger
+	logger.Infow("verifying output", "filename", outputFilename)
+
+	// Counting frames would read the whole output, so the duration comes from the container instead.  Reading every
+	// frame is left to FullDecode.
+	probe := &AnalyzeVideo{
+		Logger:           logger,
+		SkipFrameCount:   true,
+		UseLowerPriority: t.UseLowerPriority,
+	}
+	output, err := probe.Do(ctx, outputFilename)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerifyFailed, err)
+	}
+
+	problems := t.compare(source, output, opts)
+	if len(problems) == 0 && t.FullDecode {
+		if err := t.decode(ctx, outputFilename); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrVerifyFailed, strings.Join(problems, "; "))
+	}
+
+	logger.Infow("output verified", "filename", outputFilename)
+	return nil
+}
+
+// compare returns a description of every way output differs from what transcoding source with opts should produce
+func (t *VerifyVideo) compare(source, output *AnalyzeResults, opts TranscodeVideoOptions) []string {
+	problems := make([]string, 0)
+	if source == nil {
+		// Without a source to compare with, the best we can do is make sure there's something to watch
+		if output.NumVideoStreams == 0 && !opts.DiscardVideo {
+			problems = append(problems, "no video streams")
+		}
+		return problems
+	}
+
+	checks := []struct {
+		name             string
+		source, output   int
+		discard, copyAll bool
+	}{
+		{"video", source.NumVideoStreams, output.NumVideoStreams, opts.DiscardVideo, opts.CopyAllVideoStreams},
+		{"audio", source.NumAudioStreams, output.NumAudioStreams, opts.DiscardAudio, opts.CopyAllAudioStreams},
+		{"subtitle", source.NumSubtitleStreams, output.NumSubtitleStreams, opts.DiscardSubtitles, opts.CopyAllSubtitleStreams},
+	}
+	for _, check := range checks {
+		// Without discarding or copying everything, streams may be filtered, but at least one should be kept
+		minimum, maximum := min(1, check.source), check.source
+		switch {
+		case check.discard:
+			minimum, maximum = 0, 0
+		case check.copyAll:
+			minimum = check.source
+		case check.name == "subtitle":
+			minimum = 0
+		}
+
+		if check.output < minimum || check.output > maximum {
+			expected := fmt.Sprintf("%d-%d", minimum, maximum)
+			if minimum == maximum {
+				expected = fmt.Sprint(minimum)
+			}
+			problems = append(problems, fmt.Sprintf("%d %s streams, expected %s", check.output, check.name, expected))
+		}
+	}
+
+	if source.Duration > 0 {
+		tolerance := t.DurationTolerance
+		if tolerance == 0 {
+			tolerance = defaultDurationTolerance
+		}
+
+		difference := output.Duration - source.Duration
+		if difference < -tolerance || difference > tolerance {
+			problems = append(problems, fmt.Sprintf("duration is %s, expected %s (within %s)",
+				output.Duration, source.Duration, tolerance))
+		}
+	}
+
+	if !opts.DiscardAudio {
+		problems = append(problems, missingLanguages("audio", opts.AudioLanguages, source, output)...)
+	}
+	if !opts.DiscardSubtitles {
+		problems = append(problems, missingLanguages("subtitle", opts.SubtitleLanguages, source, output)...)
+	}
+
+	return problems
+}
+
+// missingLanguages reports every language in languages that the source has a stream of streamType for, but the output
+// doesn't
+func missingLanguages(streamType string, languages []string, source, output *AnalyzeResults) []string {
+	problems := make([]string, 0)
+	for _, language := range languages {
+		if hasLanguage(source, streamType, language) && !hasLanguage(output, streamType, language) {
+			problems = append(problems, fmt.Sprintf("no %s stream for language %s", streamType, language))
+		}
+	}
+	return problems
+}
+
+func hasLanguage(results *AnalyzeResults, streamType, language string) bool {
+	for _, stream := range results.Streams {
+		if stream.Type == streamType && strings.EqualFold(stream.Language, language) {
+			return true
+		}
+	}
+	return false
+}
+
+// decode runs every frame of filename through ffmpeg, failing if it reports any errors
+func (t *VerifyVideo) decode(ctx context.Context, filename string) error {
+	t.Logger.Infow("decoding output", "filename", filename)
+	stderr := &bytes.Buffer{}
+	cmd := lowPriorityCommand(ctx, t.UseLowerPriority, "ffmpeg", "-v", "error", "-i", filename, "-f", "null", "-")
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("decoding failed: %v: %s", err, firstLines(stderr.String(), 5))
+	}
+
+	if errs := firstLines(stderr.String(), 5); errs != "" {
+		return fmt.Errorf("decoding reported errors: %s", errs)
+	}
+	return nil
+}
+
+// firstLines returns up to n lines from the start of s, since a corrupt file can produce an error for every frame
+func firstLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = append(lines[:n], fmt.Sprintf("(%d more lines)", len(lines)-n))
+	}
+	return strings.Join(lines, " | ")
+}
@@ -0,0 +1,76 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifyVideo_compare(t *testing.T) {
+	source := &AnalyzeResults{
+		Duration:           22 * time.Minute,
+		NumAudioStreams:    2,
+		NumSubtitleStreams: 1,
+		NumVideoStreams:    1,
+		Streams: []StreamInfo{
+			{Type: "video"},
+			{Type: "audio", Language: "eng"},
+			{Type: "audio", Language: "jpn"},
+			{Type: "subtitle", Language: "eng"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		output AnalyzeResults
+		opts   TranscodeVideoOptions
+		want   int // Number of problems
+	}{
+		{
+			name:   "filtered streams",
+			output: AnalyzeResults{Duration: 22*time.Minute + time.Second, NumAudioStreams: 1, NumVideoStreams: 1},
+			want:   0,
+		},
+		{
+			name:   "truncated",
+			output: AnalyzeResults{Duration: 11 * time.Minute, NumAudioStreams: 1, NumVideoStreams: 1},
+			want:   1,
+		},
+		{
+			name:   "missing audio",
+			output: AnalyzeResults{Duration: 22 * time.Minute, NumVideoStreams: 1},
+			want:   1,
+		},
+		{
+			name:   "copy all streams",
+			output: AnalyzeResults{Duration: 22 * time.Minute, NumAudioStreams: 1, NumVideoStreams: 1},
+			opts:   TranscodeVideoOptions{CopyAllAudioStreams: true, CopyAllSubtitleStreams: true},
+			want:   2,
+		},
+		{
+			name:   "discarded subtitles kept",
+			output: AnalyzeResults{Duration: 22 * time.Minute, NumAudioStreams: 1, NumSubtitleStreams: 1, NumVideoStreams: 1},
+			opts:   TranscodeVideoOptions{DiscardSubtitles: true},
+			want:   1,
+		},
+		{
+			name: "missing language",
+			output: AnalyzeResults{
+				Duration:        22 * time.Minute,
+				NumAudioStreams: 1,
+				NumVideoStreams: 1,
+				Streams:         []StreamInfo{{Type: "video"}, {Type: "audio", Language: "eng"}},
+			},
+			// French isn't in the source, so it can't be expected in the output
+			opts: TranscodeVideoOptions{AudioLanguages: []string{"eng", "jpn", "fre"}},
+			want: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := &VerifyVideo{}
+			if got := task.compare(source, &tt.output, tt.opts); len(got) != tt.want {
+				t.Errorf("compare() got = %v, want %d problems", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/neptune-media/robin/pkg/pipeline"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DoneDir      = "done"        // Folder that sources are moved to after being processed
+	FailedDir    = "failed"      // Folder that sources are moved to when processing them fails
+	ReasonSuffix = ".reason.txt" // Added to the name of failed sources, for the file explaining why they failed
+
+	defaultRescan    = time.Minute
+	defaultStableFor = 30 * time.Second
+)
+
+// Job is a file that has finished arriving in a watched folder
+type Job struct {
+	Path    string // Path to the file
+	Profile string // Name of the subfolder holding the file, or empty for the top level folder
+}
+
+// RunFunc processes a single file
+type RunFunc func(ctx context.Context, job Job) error
+
+// Watcher waits for files to be dropped into a folder, or one of its subfolders, and processes them one at a time.
+// Processed files are moved into the done folder, and files that fail are moved into the failed folder along with a
+// reason file.  Both keep the subfolder the file was dropped into.
+type Watcher struct {
+	Dir        string
+	Extensions []string // Only files with these extensions are processed, ignoring case.  All files when empty
+	Logger     *zap.SugaredLogger
+	Rescan     time.Duration // How often folders are rescanned, for changes that events missed.  Defaults to 1 minute
+	Run        RunFunc
+	StableFor  time.Duration // How long a file's size must stay the same before it is processed.  Defaults to 30s
+
+	stopping atomic.Bool
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+	since   time.Time // When the size or modification time last changed
+	queued  bool
+}
+
+// Do watches for files until ctx is cancelled, or until Stop is called and the running job has finished
+func (w *Watcher) Do(ctx context.Context) error {
+	for _, dir := range []string{DoneDir, FailedDir} {
+		if err := os.MkdirAll(filepath.Join(w.Dir, dir), 0750); err != nil {
+			return err
+		}
+	}
+
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer notify.Close()
+
+	files := make(map[string]*fileState)
+	if err := w.scan(notify, files); err != nil {
+		return err
+	}
+
+	stableFor := w.getStableFor()
+	poll := time.NewTicker(min(time.Second, max(10*time.Millisecond, stableFor/4)))
+	defer poll.Stop()
+	rescan := time.NewTicker(w.getRescan())
+	defer rescan.Stop()
+
+	// Jobs run one at a time in the background, so events keep being handled while a long transcode runs
+	jobs := make(chan Job)
+	finished := make(chan string, 1)
+	defer close(jobs)
+	go func() {
+		for job := range jobs {
+			w.finish(ctx, job, w.Run(ctx, job))
+			finished <- job.Path
+		}
+	}()
+
+	var queue []Job
+	running := false
+	for {
+		if w.stopping.Load() && !running {
+			w.Logger.Infow("stopped watching", "dir", w.Dir, "queued", len(queue))
+			return nil
+		}
+
+		var next chan<- Job
+		if len(queue) > 0 && !running && !w.stopping.Load() {
+			next = jobs
+		}
+
+		var job Job
+		if len(queue) > 0 {
+			job = queue[0]
+		}
+
+		select {
+		case <-ctx.Done():
+			// Give the running job a chance to clean up after itself
+			if running {
+				<-finished
+			}
+			return ctx.Err()
+		case next <- job:
+			queue = queue[1:]
+			running = true
+		case path := <-finished:
+			delete(files, path)
+			running = false
+		case event, ok := <-notify.Events:
+			if !ok {
+				return errors.New("file watcher closed")
+			}
+			w.handleEvent(notify, files, event)
+		case err, ok := <-notify.Errors:
+			if !ok {
+				return errors.New("file watcher closed")
+			}
+			w.Logger.Warnw("error while watching for files, relying on rescans", "err", err)
+		case <-rescan.C:
+			if err := w.scan(notify, files); err != nil {
+				w.Logger.Warnw("error while rescanning folders", "dir", w.Dir, "err", err)
+			}
+		case now := <-poll.C:
+			for _, path := range w.checkStable(files, now, stableFor) {
+				queue = append(queue, Job{Path: path, Profile: w.profile(path)})
+				w.Logger.Infow("queued file", "path", path, "queued", len(queue))
+			}
+		}
+	}
+}
+
+// Stop stops the watcher from starting new jobs, letting the running job finish
+func (w *Watcher) Stop() {
+	w.stopping.Store(true)
+}
+
+// scan watches the folder and its subfolders, and tracks every file already in them
+func (w *Watcher) scan(notify *fsnotify.Watcher, files map[string]*fileState) error {
+	if err := notify.Add(w.Dir); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(w.Dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(w.Dir, entry.Name())
+		if !entry.IsDir() {
+			w.track(files, path)
+			continue
+		}
+		if w.isProfileDir(path) {
+			w.scanProfileDir(notify, files, path)
+		}
+	}
+
+	return nil
+}
+
+func (w *Watcher) scanProfileDir(notify *fsnotify.Watcher, files map[string]*fileState, dir string) {
+	if err := notify.Add(dir); err != nil {
+		w.Logger.Warnw("error while watching folder", "dir", dir, "err", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		w.Logger.Warnw("error while scanning folder", "dir", dir, "err", err)
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			w.track(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+func (w *Watcher) handleEvent(notify *fsnotify.Watcher, files map[string]*fileState, event fsnotify.Event) {
+	switch {
+	case event.Has(fsnotify.Create):
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			// New subfolders may arrive with files already in them
+			if w.isProfileDir(event.Name) {
+				w.scanProfileDir(notify, files, event.Name)
+			}
+			return
+		}
+		w.track(files, event.Name)
+	case event.Has(fsnotify.Write):
+		w.track(files, event.Name)
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		// Renamed files show up again with a create event for their new name
+		if state, ok := files[event.Name]; ok && !state.queued {
+			delete(files, event.Name)
+		}
+	}
+}
+
+// track starts waiting for path to become stable, unless it's already tracked
+func (w *Watcher) track(files map[string]*fileState, path string) {
+	if _, ok := files[path]; ok || !w.isCandidate(path) {
+		return
+	}
+
+	files[path] = &fileState{size: -1}
+}
+
+// checkStable returns tracked files that haven't changed for stableFor, and marks them as queued
+func (w *Watcher) checkStable(files map[string]*fileState, now time.Time, stableFor time.Duration) []string {
+	var stable []string
+	for path, state := range files {
+		if state.queued {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			delete(files, path)
+			continue
+		}
+
+		if info.Size() != state.size || !info.ModTime().Equal(state.modTime) {
+			state.size = info.Size()
+			state.modTime = info.ModTime()
+			state.since = now
+			continue
+		}
+
+		if now.Sub(state.since) >= stableFor {
+			state.queued = true
+			stable = append(stable, path)
+		}
+	}
+
+	return stable
+}
+
+// finish moves the file for job into the done or failed folder
+func (w *Watcher) finish(ctx context.Context, job Job, err error) {
+	// Interrupted jobs are left where they are, to be tried again next time
+	if err != nil && ctx.Err() != nil {
+		w.Logger.Warnw("interrupted while processing file", "path", job.Path, "err", err)
+		return
+	}
+
+	dir := DoneDir
+	if err != nil {
+		dir = FailedDir
+	}
+	dir = filepath.Join(w.Dir, dir, job.Profile)
+	if mkErr := os.MkdirAll(dir, 0750); mkErr != nil {
+		w.Logger.Errorw("error while creating folder", "dir", dir, "err", mkErr)
+		return
+	}
+
+	dest := pipeline.AvailablePath(filepath.Join(dir, filepath.Base(job.Path)))
+	if mvErr := os.Rename(job.Path, dest); mvErr != nil {
+		w.Logger.Errorw("error while moving processed file", "path", job.Path, "dest", dest, "err", mvErr)
+		return
+	}
+
+	if err == nil {
+		w.Logger.Infow("processed file", "path", job.Path, "dest", dest)
+		return
+	}
+
+	w.Logger.Errorw("error while processing file", "path", job.Path, "dest", dest, "err", err)
+	reason := fmt.Sprintf("Processing %s failed at %s\n\n%s\n", job.Path, time.Now().Format(time.RFC3339), err)
+	if err := os.WriteFile(dest+ReasonSuffix, []byte(reason), 0640); err != nil {
+		w.Logger.Errorw("error while writing reason file", "path", dest+ReasonSuffix, "err", err)
+	}
+}
+
+// isCandidate reports whether path is a file that should be processed once it's stable
+func (w *Watcher) isCandidate(path string) bool {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".") || strings.HasSuffix(name, ReasonSuffix) {
+		return false
+	}
+
+	dir := filepath.Dir(path)
+	if dir != filepath.Clean(w.Dir) && !w.isProfileDir(dir) {
+		return false
+	}
+
+	if len(w.Extensions) == 0 {
+		return true
+	}
+	ext := filepath.Ext(name)
+	for _, allowed := range w.Extensions {
+		if strings.EqualFold(ext, "."+strings.TrimPrefix(allowed, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// isProfileDir reports whether dir is a direct subfolder of the watched folder that files can be dropped into
+func (w *Watcher) isProfileDir(dir string) bool {
+	name := filepath.Base(dir)
+	return filepath.Dir(dir) == filepath.Clean(w.Dir) &&
+		name != DoneDir && name != FailedDir && !strings.HasPrefix(name, ".")
+}
+
+// profile returns the name of the subfolder holding path, or an empty string for the top level folder
+func (w *Watcher) profile(path string) string {
+	dir := filepath.Dir(path)
+	if dir == filepath.Clean(w.Dir) {
+		return ""
+	}
+	return filepath.Base(dir)
+}
+
+func (w *Watcher) getRescan() time.Duration {
+	if w.Rescan <= 0 {
+		return defaultRescan
+	}
+	return w.Rescan
+}
+
+func (w *Watcher) getStableFor() time.Duration {
+	if w.StableFor <= 0 {
+		return defaultStableFor
+	}
+	return w.StableFor
+}
@@ -0,0 +1,131 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitForFile(t *testing.T, path string) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", path)
+}
+
+func TestWatcher_Do(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "existing.mkv"), "ripped before starting")
+
+	var mu sync.Mutex
+	var jobs []Job
+	w := &Watcher{
+		Dir:        dir,
+		Extensions: []string{"mkv"},
+		Logger:     zap.NewNop().Sugar(),
+		StableFor:  100 * time.Millisecond,
+		Run: func(ctx context.Context, job Job) error {
+			mu.Lock()
+			jobs = append(jobs, job)
+			mu.Unlock()
+			if strings.Contains(job.Path, "broken") {
+				return errors.New("transcode failed")
+			}
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Do(ctx) }()
+
+	waitForFile(t, filepath.Join(dir, DoneDir, "existing.mkv"))
+
+	writeTestFile(t, filepath.Join(dir, "anime", "episodes.mkv"), "new rip")
+	writeTestFile(t, filepath.Join(dir, "anime", "notes.txt"), "not a video")
+	writeTestFile(t, filepath.Join(dir, "broken.mkv"), "bad rip")
+	waitForFile(t, filepath.Join(dir, DoneDir, "anime", "episodes.mkv"))
+	waitForFile(t, filepath.Join(dir, FailedDir, "broken.mkv"+ReasonSuffix))
+
+	w.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Do() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Do() didn't return after Stop()")
+	}
+	cancel()
+
+	reason, _ := os.ReadFile(filepath.Join(dir, FailedDir, "broken.mkv"+ReasonSuffix))
+	if !strings.Contains(string(reason), "transcode failed") {
+		t.Errorf("reason file got = %q, want the error", reason)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "anime", "notes.txt")); err != nil {
+		t.Errorf("file with other extension was moved: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(jobs) != 3 {
+		t.Fatalf("Do() ran %d jobs, want 3", len(jobs))
+	}
+	for _, job := range jobs {
+		wantProfile := ""
+		if strings.Contains(job.Path, "anime") {
+			wantProfile = "anime"
+		}
+		if job.Profile != wantProfile {
+			t.Errorf("job for %s got profile = %q, want %q", job.Path, job.Profile, wantProfile)
+		}
+	}
+}
+
+func TestWatcher_isCandidate(t *testing.T) {
+	dir := filepath.Join("srv", "inbox")
+	w := &Watcher{Dir: dir, Extensions: []string{".mkv", "mp4"}}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: filepath.Join(dir, "movie.mkv"), want: true},
+		{path: filepath.Join(dir, "movie.MP4"), want: true},
+		{path: filepath.Join(dir, "anime", "episodes.mkv"), want: true},
+		{path: filepath.Join(dir, "movie.txt"), want: false},
+		{path: filepath.Join(dir, ".movie.mkv"), want: false},
+		{path: filepath.Join(dir, "movie.mkv"+ReasonSuffix), want: false},
+		{path: filepath.Join(dir, DoneDir, "movie.mkv"), want: false},
+		{path: filepath.Join(dir, FailedDir, "anime", "movie.mkv"), want: false},
+		{path: filepath.Join(dir, "anime", "disc1", "movie.mkv"), want: false},
+		{path: filepath.Join(dir, ".sync", "movie.mkv"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := w.isCandidate(tt.path); got != tt.want {
+				t.Errorf("isCandidate() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}